@@ -0,0 +1,156 @@
+package godl
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// auditReport lists how a GOROOT differs from the official archive of its version.
+type auditReport struct {
+	Version  string   `json:"version"`
+	GoRoot   string   `json:"goroot"`
+	Checked  int      `json:"checked"`
+	Added    []string `json:"added"`
+	Missing  []string `json:"missing"`
+	Modified []string `json:"modified"`
+}
+
+func (r auditReport) drifted() bool {
+	return len(r.Added)+len(r.Missing)+len(r.Modified) > 0
+}
+
+// auditGoRoot compares every file of goRoot with the official archive of the
+// version it records and fails when they differ.
+func auditGoRoot(ctx context.Context, src Source, iv InstalledVersion, goRoot string) error {
+	if v, err := readVersionFile(goRoot); err == nil {
+		iv.Version = v
+	}
+	if iv.Version == "" {
+		return errors.Errorf("cannot determine the version of %s", goRoot)
+	}
+	file, err := getVersionFile(ctx, func(ctx context.Context) ([]Release, error) {
+		return Releases(ctx, ReleaseOptions{Source: src, All: true, Channel: "all"})
+	}, iv, iv.Version)
+	if err != nil {
+		return err
+	}
+	if file.Kind != "archive" {
+		return errors.Errorf("%s is not an archive", file.Filename)
+	}
+	archivePath, temp, err := fetchArchive(ctx, src, file)
+	if temp {
+		defer removeDownload(archivePath)
+	}
+	if err != nil {
+		return err
+	}
+	if err := verifyArchive(file, archivePath); err != nil {
+		return err
+	}
+	report, err := auditTree(archivePath, goRoot)
+	if err != nil {
+		return err
+	}
+	report.Version = iv.Version
+	if err := printAudit(report, file.Filename); err != nil {
+		return err
+	}
+	if report.drifted() {
+		return errors.Errorf("%s differs from the official %s archive", goRoot, iv.Version)
+	}
+	return nil
+}
+
+// printAudit prints report, as JSON with -json, naming what GOROOT was checked
+// against.
+func printAudit(report auditReport, against string) error {
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	for _, p := range report.Added {
+		fmt.Fprintf(stdout, "added:    %s\n", p)
+	}
+	for _, p := range report.Missing {
+		fmt.Fprintf(stdout, "missing:  %s\n", p)
+	}
+	for _, p := range report.Modified {
+		fmt.Fprintf(stdout, "modified: %s\n", p)
+	}
+	fmt.Fprintf(stdout, "audited %s against %s: %d files checked, %d added, %d missing, %d modified\n",
+		report.GoRoot, against, report.Checked, len(report.Added), len(report.Missing), len(report.Modified))
+	return nil
+}
+
+// auditTree hashes the regular files of the .tar.gz archive at path and compares
+// them with the files of goRoot, which corresponds to the go directory of the
+// archive. Nothing is written.
+func auditTree(archivePath, goRoot string) (auditReport, error) {
+	report := auditReport{GoRoot: goRoot}
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return report, err
+	}
+	defer f.Close()
+	gzr, err := gzip.NewReader(f)
+	if err != nil {
+		return report, withKind(ErrArchiveInvalid, err)
+	}
+	tr := tar.NewReader(gzr)
+	official := make(map[string]bool)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return report, withKind(ErrArchiveInvalid, err)
+		}
+		rel, ok := strings.CutPrefix(path.Clean(header.Name), "go/")
+		if !ok || header.Typeflag != tar.TypeReg {
+			continue
+		}
+		official[rel] = true
+		report.Checked++
+		h := sha256.New()
+		if _, err := io.Copy(h, tr); err != nil {
+			return report, withKind(ErrArchiveInvalid, err)
+		}
+		sum, err := hashFile(filepath.Join(goRoot, filepath.FromSlash(rel)))
+		switch {
+		case os.IsNotExist(err):
+			report.Missing = append(report.Missing, rel)
+		case err != nil:
+			return report, err
+		case sum != hex.EncodeToString(h.Sum(nil)):
+			report.Modified = append(report.Modified, rel)
+		}
+	}
+	local, err := treeFiles(goRoot)
+	if err != nil {
+		return report, err
+	}
+	for rel := range local {
+		if !official[rel] {
+			report.Added = append(report.Added, rel)
+		}
+	}
+	sort.Strings(report.Added)
+	sort.Strings(report.Missing)
+	sort.Strings(report.Modified)
+	return report, nil
+}
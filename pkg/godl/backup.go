@@ -0,0 +1,192 @@
+package godl
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultBackupTemplate = "{name}@{version}"
+	backupTimestampLayout = "20060102150405"
+	// backupMarker is the file in a backup recording when it was made, since
+	// renaming a tree does not reliably change its modification time.
+	backupMarker = ".godl-backup"
+)
+
+// renderBackupPath expands the backup template for goRoot and returns the absolute
+// path the current installation should be moved to. The template supports the
+// placeholders {name} (base name of GOROOT), {version} and {timestamp}; the result
+// lives under root, or next to GOROOT when root is empty.
+func renderBackupPath(tmpl, root, goRoot, version string, now time.Time) (string, error) {
+	if tmpl == "" {
+		tmpl = defaultBackupTemplate
+	}
+	name := strings.NewReplacer(
+		"{name}", filepath.Base(goRoot),
+		"{version}", version,
+		"{timestamp}", now.Format(backupTimestampLayout),
+	).Replace(tmpl)
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return "", errors.Errorf("invalid backup directory name %q rendered from template %q", name, tmpl)
+	}
+	if root == "" {
+		root = filepath.Dir(goRoot)
+	}
+	p := filepath.Join(root, name)
+	if filepath.Clean(p) == filepath.Clean(goRoot) {
+		return "", errors.Errorf("backup path %s is the same as GOROOT", p)
+	}
+	if _, err := os.Lstat(p); err == nil {
+		return "", errors.Errorf("backup path %s already exists", p)
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+	return p, nil
+}
+
+// restoreBackup moves the installation at goRoot aside, puts backupPath back in its
+// place and then removes the discarded installation.
+func restoreBackup(goRoot, backupPath string) error {
+	discarded := filepath.Join(filepath.Dir(goRoot), filepath.Base(goRoot)+".discarded")
+	if err := os.Rename(goRoot, discarded); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Rename(backupPath, goRoot); err != nil {
+		return err
+	}
+	return os.RemoveAll(discarded)
+}
+
+// backup is a previous installation moved aside by an install.
+type backup struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+	Size    int64  `json:"size"`
+	// Modified is when the backup was made
+	Modified time.Time `json:"modified"`
+}
+
+// markBackup records in the backup at p that it was made at now.
+func markBackup(p string, now time.Time) error {
+	return os.WriteFile(filepath.Join(p, backupMarker), []byte(now.UTC().Format(time.RFC3339Nano)+"\n"), 0644)
+}
+
+// backupTime returns when the backup at p was made, from its marker, or for
+// backups made before markers were written, the modification time of the tree.
+func backupTime(p string, info fs.FileInfo) time.Time {
+	if b, err := os.ReadFile(filepath.Join(p, backupMarker)); err == nil {
+		if t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(b))); err == nil {
+			return t
+		}
+	}
+	return info.ModTime()
+}
+
+// backupPrefix returns the literal start of the backup names rendered from tmpl,
+// which is everything before the first placeholder that varies between backups.
+// A template starting with {version} or {timestamp} has no such start and would
+// make every Go tree next to GOROOT a backup, so it is refused.
+func backupPrefix(tmpl, goRoot string) (string, error) {
+	if tmpl == "" {
+		tmpl = defaultBackupTemplate
+	}
+	prefix := strings.ReplaceAll(tmpl, "{name}", filepath.Base(goRoot))
+	if i := strings.IndexByte(prefix, '{'); i >= 0 {
+		prefix = prefix[:i]
+	}
+	if prefix == "" {
+		return "", errors.Errorf("invalid backup directory template %q, it must start with {name} or fixed text", tmpl)
+	}
+	return prefix, nil
+}
+
+// findBackups returns the backups of goRoot, most recently made first. Backups are the Go trees
+// next to GOROOT and in the backup root whose names carry the prefix of the backup
+// template; their version is read from the VERSION file rather than parsed from the
+// name.
+func findBackups(goRoot, tmpl, root string) ([]backup, error) {
+	dirs := []string{filepath.Dir(goRoot)}
+	if root != "" && filepath.Clean(root) != filepath.Clean(dirs[0]) {
+		dirs = append(dirs, root)
+	}
+	prefix, err := backupPrefix(tmpl, goRoot)
+	if err != nil {
+		return nil, err
+	}
+	var backups []backup
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		for _, e := range entries {
+			p := filepath.Join(dir, e.Name())
+			if !e.IsDir() || !strings.HasPrefix(e.Name(), prefix) || filepath.Clean(p) == filepath.Clean(goRoot) {
+				continue
+			}
+			v, err := readVersionFile(p)
+			if err != nil {
+				continue
+			}
+			info, err := e.Info()
+			if err != nil {
+				return nil, err
+			}
+			size, err := dirSize(p)
+			if err != nil {
+				return nil, err
+			}
+			backups = append(backups, backup{Path: p, Version: v, Size: size, Modified: backupTime(p, info)})
+		}
+	}
+	sort.SliceStable(backups, func(i, j int) bool {
+		return backups[i].Modified.After(backups[j].Modified)
+	})
+	return backups, nil
+}
+
+// pruneBackups removes all but the keep newest backups of goRoot, newest by their
+// version, printing each one it removes. goRoot itself is never a backup.
+func pruneBackups(goRoot, tmpl, root string, keep int) error {
+	backups, err := findBackups(goRoot, tmpl, root)
+	if err != nil || len(backups) <= keep {
+		return err
+	}
+	sort.SliceStable(backups, func(i, j int) bool {
+		return versionLess(backups[j].Version, backups[i].Version)
+	})
+	for _, b := range backups[keep:] {
+		if err := os.RemoveAll(b.Path); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "removed backup: %s (%s)\n", b.Path, b.Version)
+	}
+	return nil
+}
+
+// dirSize returns the total size of the regular files under dir.
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
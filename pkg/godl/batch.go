@@ -0,0 +1,148 @@
+package godl
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// installResult is the outcome of installing one version of a batch.
+type installResult struct {
+	Version string
+	Root    string
+	Err     error
+}
+
+// installVersions installs each of versions into versionsDir. The first failure
+// stops the batch unless -keep-going is set, in which case every version is tried
+// and a summary of the results is printed at the end.
+func installVersions(ctx context.Context, src Source, iv InstalledVersion, versions []string) error {
+	rs, err := Releases(ctx, ReleaseOptions{Source: src, All: true, Channel: "all"})
+	if err != nil {
+		return err
+	}
+	fetch := func(ctx context.Context) ([]Release, error) { return rs, nil }
+
+	workers := parallel
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > 1 {
+		// the per download progress lines would overwrite each other
+		batch = &batchProgress{}
+		stop := batch.run()
+		defer func() {
+			stop()
+			batch = nil
+		}()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		sem      = make(chan struct{}, workers)
+		results  = make([]installResult, len(versions))
+	)
+	for i, v := range versions {
+		if !strings.HasPrefix(v, "go") {
+			v = "go" + v
+		}
+		wg.Add(1)
+		go func(i int, v string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			if err := ctx.Err(); err != nil {
+				results[i] = installResult{Version: v, Err: err}
+				return
+			}
+			root, err := installVersion(ctx, src, fetch, iv, v)
+			results[i] = installResult{Version: v, Root: root, Err: err}
+			if err != nil && !keepGoing {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = errors.Wrap(err, v)
+					// the other installs are abandoned
+					cancel()
+				}
+				mu.Unlock()
+			}
+		}(i, v)
+	}
+	wg.Wait()
+	if !keepGoing {
+		return firstErr
+	}
+
+	failed := 0
+	for _, r := range results {
+		switch {
+		case r.Err != nil:
+			failed++
+			fmt.Fprintf(stdout, "%-12s %s\n", r.Version, colorize(os.Stdout, colorRed, "failed: "+r.Err.Error()))
+		case r.Root == "":
+			fmt.Fprintf(stdout, "%-12s %s\n", r.Version, "not installed, dry run")
+		default:
+			fmt.Fprintf(stdout, "%-12s %s\n", r.Version, colorize(os.Stdout, colorGreen, "installed in "+r.Root))
+		}
+	}
+	if failed > 0 {
+		return errors.Errorf("%d of %d installs failed", failed, len(results))
+	}
+	return nil
+}
+
+// installVersion downloads version and moves it into versionsDir, returning the
+// root of the new tree, or an empty root on a dry run.
+func installVersion(ctx context.Context, src Source, fetch func(ctx context.Context) ([]Release, error), iv InstalledVersion, version string) (string, error) {
+	file, err := getVersionFile(ctx, fetch, iv, version)
+	if err != nil {
+		return "", err
+	}
+	if file.Kind != "archive" {
+		return "", errors.Errorf("%s is not an archive", file.Filename)
+	}
+	if dryRun {
+		fmt.Fprintf(stdout, "would install %s into %s\n", file.Filename, filepath.Join(versionsDir, version))
+		return "", nil
+	}
+
+	archivePath, temp, err := fetchArchive(ctx, src, file)
+	if temp {
+		defer removeDownload(archivePath)
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := verifyArchive(file, archivePath); err != nil {
+		return "", err
+	}
+	r, err := os.Open(archivePath)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	if err := os.MkdirAll(versionsDir, 0755); err != nil {
+		return "", err
+	}
+	extractDir, err := os.MkdirTemp(versionsDir, ".staging-")
+	if err != nil {
+		return "", err
+	}
+	defer removeStaging(extractDir)
+	pr := newProgressReader(r)
+	if err := extractRelease(pr, file.Filename, extractDir); err != nil {
+		return "", errors.Wrap(err, "extract archive error")
+	}
+	pr.finish()
+	return installVersioned(filepath.Join(extractDir, archiveRoot), versionsDir, fileVersion(file))
+}
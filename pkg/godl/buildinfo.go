@@ -0,0 +1,56 @@
+package godl
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+)
+
+// Set at build time with -ldflags "-X github.com/e2u/godl/pkg/godl.buildVersion=v1.2.3",
+// and likewise buildCommit and buildDate. Builds without them fall back to the
+// module and VCS information recorded by the go command.
+var (
+	buildVersion = ""
+	buildCommit  = ""
+	buildDate    = ""
+)
+
+// versionInfo returns the version, commit and build date of this binary.
+func versionInfo() (version, commit, date string) {
+	version, commit, date = buildVersion, buildCommit, buildDate
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if version == "" && bi.Main.Version != "" {
+			version = bi.Main.Version
+		}
+		vcs := make(map[string]string)
+		for _, s := range bi.Settings {
+			vcs[s.Key] = s.Value
+		}
+		if commit == "" && vcs["vcs.revision"] != "" {
+			commit = vcs["vcs.revision"]
+			if vcs["vcs.modified"] == "true" {
+				commit += "-dirty"
+			}
+		}
+		if date == "" {
+			date = vcs["vcs.time"]
+		}
+	}
+	if version == "" {
+		version = "(devel)"
+	}
+	if commit == "" {
+		commit = "unknown"
+	}
+	if date == "" {
+		date = "unknown"
+	}
+	return version, commit, date
+}
+
+// printVersionInfo writes the -V output to w.
+func printVersionInfo(w io.Writer) {
+	version, commit, date := versionInfo()
+	fmt.Fprintf(w, "godl %s (commit %s, built %s, %s %s/%s)\n", version, commit, date, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
@@ -0,0 +1,142 @@
+package godl
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// A bundle is an uncompressed tar holding everything an offline install needs:
+// the release list entry of one version as a -releases-file, and its archive stored
+// under its -cache-archives name, which carries the sha256 it is checked against.
+const (
+	bundleReleases = "releases.json"
+	// maxBundleMeta bounds the size of the release list read from a bundle.
+	maxBundleMeta = 1 << 20
+)
+
+// writeBundle writes the verified archive at path, the release file of r, to
+// the bundle at out.
+func writeBundle(out string, r Release, file File, path string) error {
+	if file.Sha256 == "" {
+		return errors.Errorf("%s has no published sha256, a bundle could not be verified offline", file.Filename)
+	}
+	r.Files = []File{file}
+	meta, err := json.MarshalIndent([]Release{r}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(out), ".tmp-"+filepath.Base(out))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	tw := tar.NewWriter(f)
+	now := time.Now()
+	if err := tw.WriteHeader(&tar.Header{Name: bundleReleases, Mode: 0644, Size: int64(len(meta)), ModTime: now}); err == nil {
+		_, err = tw.Write(meta)
+	}
+	if err == nil {
+		err = addBundleFile(tw, cacheKey(file), path)
+	}
+	if err == nil {
+		err = tw.Close()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return errors.Wrapf(err, "write bundle %s", out)
+	}
+	return os.Rename(f.Name(), out)
+}
+
+// addBundleFile adds the file at path to tw under name.
+func addBundleFile(tw *tar.Writer, name, path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: info.Size(), ModTime: info.ModTime()}); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, in)
+	return err
+}
+
+// readBundle unpacks the bundle at path into dir and returns the version it holds.
+// Only the release list and cache entries are taken, the archive is verified
+// against its sha256 when cachedArchive picks it up.
+func readBundle(path, dir string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	tr := tar.NewReader(f)
+	var rs []Release
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", errors.Wrapf(err, "read bundle %s", path)
+		}
+		name := h.Name
+		switch {
+		case h.Typeflag != tar.TypeReg:
+			continue
+		case name == bundleReleases:
+			b, err := io.ReadAll(io.LimitReader(tr, maxBundleMeta))
+			if err != nil {
+				return "", err
+			}
+			if rs, err = decodeReleaseList(path, b); err != nil {
+				return "", err
+			}
+			if err := os.WriteFile(filepath.Join(dir, bundleReleases), b, 0644); err != nil {
+				return "", err
+			}
+		case len(name) > sha256HexLen && name[sha256HexLen] == '-' && !strings.ContainsAny(name, `/\`):
+			out, err := os.Create(filepath.Join(dir, name))
+			if err != nil {
+				return "", err
+			}
+			_, err = io.Copy(out, tr)
+			if cerr := out.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return "", errors.Wrapf(err, "read bundle %s", path)
+			}
+		}
+	}
+	if len(rs) != 1 {
+		return "", errors.Errorf("%s is not a godl bundle, it has no %s with one release", path, bundleReleases)
+	}
+	return rs[0].Version, nil
+}
+
+// bundlePath returns where godl bundle writes the bundle of version: -o when it
+// names a .tar file, otherwise godl-<version>.tar in that directory.
+func bundlePath(out, version string) string {
+	if strings.HasSuffix(out, ".tar") {
+		return out
+	}
+	return filepath.Join(out, "godl-"+version+".tar")
+}
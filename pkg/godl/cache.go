@@ -0,0 +1,118 @@
+package godl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Cached archives are stored as <sha256>-<filename> so the expected digest of an
+// entry can always be recovered from its name.
+const sha256HexLen = sha256.Size * 2
+
+// hashFile returns the hex encoded SHA256 digest of the file at path.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func cacheKey(file File) string {
+	return strings.ToLower(file.Sha256) + "-" + filepath.Base(file.Filename)
+}
+
+// cachedArchive returns the path of the cached archive for file if one exists and
+// its content still matches the published digest.
+func cachedArchive(dir string, file File) (string, bool) {
+	if file.Sha256 == "" {
+		return "", false
+	}
+	p := filepath.Join(dir, cacheKey(file))
+	sum, err := hashFile(p)
+	if err != nil || !strings.EqualFold(sum, file.Sha256) {
+		return "", false
+	}
+	return p, true
+}
+
+// storeArchive copies the downloaded archive at path into the cache.
+func storeArchive(dir string, file File, path string) error {
+	if file.Sha256 == "" {
+		return errors.Errorf("%s has no published sha256, not caching", file.Filename)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return copyFile(path, filepath.Join(dir, cacheKey(file)))
+}
+
+type cacheReport struct {
+	Checked int
+	OK      int
+	Corrupt []string
+}
+
+// verifyCache re-hashes every cached archive in dir with a bounded worker pool and
+// reports the entries whose content no longer matches the digest in their name.
+// Corrupt entries are deleted when remove is set.
+func verifyCache(dir string, remove bool) (cacheReport, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return cacheReport{}, err
+	}
+
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		report cacheReport
+		paths  = make(chan string)
+	)
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range paths {
+				want := filepath.Base(p)[:sha256HexLen]
+				sum, err := hashFile(p)
+				ok := err == nil && strings.EqualFold(sum, want)
+				if !ok && remove {
+					if err := os.Remove(p); err != nil {
+						warnf("remove %s error: %s", p, err)
+					}
+				}
+				mu.Lock()
+				report.Checked++
+				if ok {
+					report.OK++
+				} else {
+					report.Corrupt = append(report.Corrupt, p)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if !e.Type().IsRegular() || len(name) <= sha256HexLen || name[sha256HexLen] != '-' {
+			continue
+		}
+		paths <- filepath.Join(dir, name)
+	}
+	close(paths)
+	wg.Wait()
+	return report, nil
+}
@@ -0,0 +1,103 @@
+package godl
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// checksumKey identifies a release file in a -checksums-db.
+type checksumKey struct {
+	Version, OS, Arch, Kind string
+}
+
+// checksumDB maps release files to their approved sha256 digests.
+type checksumDB map[checksumKey]string
+
+var sha256Pattern = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+// loadChecksumDB reads the -checksums-db file at path.
+func loadChecksumDB(path string) (checksumDB, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	db, err := parseChecksumDB(f)
+	return db, errors.Wrap(err, path)
+}
+
+// parseChecksumDB parses a checksums database. Every line holds
+//
+//	version os arch sha256 [kind]
+//
+// separated by white space, e.g. "go1.22.9 linux amd64 84a8...". kind is archive
+// when left out; source archives use - for os and arch. Empty lines and lines
+// starting with # are ignored.
+func parseChecksumDB(r io.Reader) (checksumDB, error) {
+	db := checksumDB{}
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fs := strings.Fields(line)
+		if len(fs) != 4 && len(fs) != 5 {
+			return nil, errors.Errorf("line %d: want version os arch sha256 [kind], got %q", n, line)
+		}
+		if !versionPattern.MatchString(fs[0]) {
+			return nil, errors.Errorf("line %d: invalid version %q", n, fs[0])
+		}
+		if !sha256Pattern.MatchString(fs[3]) {
+			return nil, errors.Errorf("line %d: invalid sha256 %q", n, fs[3])
+		}
+		k := checksumKey{Version: fs[0], OS: fs[1], Arch: fs[2], Kind: "archive"}
+		if len(fs) == 5 {
+			k.Kind = fs[4]
+		}
+		if k.OS == "-" {
+			k.OS = ""
+		}
+		if k.Arch == "-" {
+			k.Arch = ""
+		}
+		if prev, ok := db[k]; ok && !strings.EqualFold(prev, fs[3]) {
+			return nil, errors.Errorf("line %d: conflicting sha256 for %s %s/%s", n, k.Version, k.OS, k.Arch)
+		}
+		db[k] = strings.ToLower(fs[3])
+	}
+	return db, sc.Err()
+}
+
+// lookup returns the approved digest of f and fails when f is not listed. A
+// release list digest that disagrees with it is reported.
+func (db checksumDB) lookup(f File) (string, error) {
+	k := checksumKey{Version: fileVersion(f), OS: f.Os, Arch: f.Arch, Kind: f.Kind}
+	sum, ok := db[k]
+	if !ok {
+		return "", errors.Errorf("%s is not listed in -checksums-db", f.Filename)
+	}
+	if f.Sha256 != "" && !strings.EqualFold(f.Sha256, sum) {
+		warnf("%s: the release list digest %s differs from -checksums-db %s", f.Filename, f.Sha256, sum)
+	}
+	return sum, nil
+}
+
+// checksumDBVerifier checks files against the approved digests of a checksums
+// database instead of the ones in the release list.
+type checksumDBVerifier struct {
+	db checksumDB
+}
+
+func (v checksumDBVerifier) Verify(file File, path string) error {
+	want, err := v.db.lookup(file)
+	if err != nil {
+		return err
+	}
+	return verifyChecksum(path, want)
+}
@@ -0,0 +1,89 @@
+package godl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	sumA = "84a8b7e9c2d3f4a5b6c7d8e9f0a1b2c3d4e5f60718293a4b5c6d7e8f90a1b2c3"
+	sumB = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+)
+
+func TestParseChecksumDB(t *testing.T) {
+	db, err := parseChecksumDB(strings.NewReader(`# approved toolchains
+go1.22.9 linux amd64 ` + sumA + `
+
+go1.22.9	darwin	arm64	` + strings.ToUpper(sumB) + `
+go1.22.9 - - ` + sumB + ` source
+go1.22.9 windows amd64 ` + sumB + ` installer
+go1.22.9 linux amd64 ` + sumA + `
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := checksumDB{
+		{Version: "go1.22.9", OS: "linux", Arch: "amd64", Kind: "archive"}:     sumA,
+		{Version: "go1.22.9", OS: "darwin", Arch: "arm64", Kind: "archive"}:    sumB,
+		{Version: "go1.22.9", Kind: "source"}:                                  sumB,
+		{Version: "go1.22.9", OS: "windows", Arch: "amd64", Kind: "installer"}: sumB,
+	}
+	if len(db) != len(want) {
+		t.Errorf("parsed %d entries, want %d: %v", len(db), len(want), db)
+	}
+	for k, sum := range want {
+		if db[k] != sum {
+			t.Errorf("%+v: %q, want %q", k, db[k], sum)
+		}
+	}
+}
+
+func TestParseChecksumDBErrors(t *testing.T) {
+	for _, tt := range []struct {
+		db, want string
+	}{
+		{"go1.22.9 linux amd64", "line 1: want version os arch sha256"},
+		{"# ok\ngo1.22.9 linux amd64 " + sumA + " archive extra", "line 2: want version os arch sha256"},
+		{"1.22.9 linux amd64 " + sumA, `line 1: invalid version "1.22.9"`},
+		{"go1.22.9 linux amd64 abc123", `line 1: invalid sha256 "abc123"`},
+		{"go1.22.9 linux amd64 " + sumA + "\ngo1.22.9 linux amd64 " + sumB, "line 2: conflicting sha256 for go1.22.9 linux/amd64"},
+	} {
+		if _, err := parseChecksumDB(strings.NewReader(tt.db)); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("parseChecksumDB(%q): %v, want %s", tt.db, err, tt.want)
+		}
+	}
+}
+
+func TestChecksumDBLookup(t *testing.T) {
+	db := checksumDB{{Version: "go1.22.9", OS: "linux", Arch: "amd64", Kind: "archive"}: sumA}
+	f := File{Filename: "go1.22.9.linux-amd64.tar.gz", Os: "linux", Arch: "amd64", Version: "go1.22.9", Kind: "archive", Sha256: sumB}
+	// the database wins over the release list
+	if sum, err := db.lookup(f); err != nil || sum != sumA {
+		t.Errorf("lookup = %s, %v, want %s", sum, err, sumA)
+	}
+	f.Arch = "arm64"
+	if _, err := db.lookup(f); err == nil {
+		t.Error("an unlisted file was approved")
+	}
+}
+
+func TestChecksumDBVerifier(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "go1.22.9.linux-amd64.tar.gz")
+	if err := os.WriteFile(p, []byte("archive"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f := File{Filename: filepath.Base(p), Os: "linux", Arch: "amd64", Version: "go1.22.9", Kind: "archive"}
+	k := checksumKey{Version: "go1.22.9", OS: "linux", Arch: "amd64", Kind: "archive"}
+	sum := sha256.Sum256([]byte("archive"))
+	good := hex.EncodeToString(sum[:])
+	if err := (checksumDBVerifier{db: checksumDB{k: good}}).Verify(f, p); err != nil {
+		t.Errorf("matching digest: %v", err)
+	}
+	if err := (checksumDBVerifier{db: checksumDB{k: sumA}}).Verify(f, p); err == nil {
+		t.Error("a mismatching digest verified")
+	}
+}
@@ -0,0 +1,62 @@
+package godl
+
+import (
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// parseOwner resolves a user[:group] spec to numeric ids. Names and numeric ids are
+// both accepted; without a group the primary group of the user is used.
+func parseOwner(spec string) (uid, gid int, err error) {
+	if runtime.GOOS == "windows" {
+		return 0, 0, errors.New("-chown is not supported on windows")
+	}
+	if os.Geteuid() != 0 {
+		return 0, 0, errors.New("-chown requires running as root")
+	}
+	name, group, hasGroup := strings.Cut(spec, ":")
+	if name == "" {
+		return 0, 0, errors.Errorf("invalid -chown value %q, want user or user:group", spec)
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		if u, err = user.LookupId(name); err != nil {
+			return 0, 0, errors.Wrapf(err, "-chown user %q", name)
+		}
+	}
+	if uid, err = strconv.Atoi(u.Uid); err != nil {
+		return 0, 0, errors.Errorf("-chown user %q has non-numeric uid %q", name, u.Uid)
+	}
+	gidText := u.Gid
+	if hasGroup && group != "" {
+		g, err := user.LookupGroup(group)
+		if err != nil {
+			if g, err = user.LookupGroupId(group); err != nil {
+				return 0, 0, errors.Wrapf(err, "-chown group %q", group)
+			}
+		}
+		gidText = g.Gid
+	}
+	if gid, err = strconv.Atoi(gidText); err != nil {
+		return 0, 0, errors.Errorf("-chown group has non-numeric gid %q", gidText)
+	}
+	return uid, gid, nil
+}
+
+// chownTree changes the owner of root and everything below it. Symbolic links are
+// changed themselves rather than their targets.
+func chownTree(root string, uid, gid int) error {
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Lchown(p, uid, gid)
+	})
+}
@@ -0,0 +1,150 @@
+package godl
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// minChunkSize keeps the chunks of -connections from getting so small that the
+// extra requests cost more than they gain.
+const minChunkSize = 4 << 20
+
+// downloadChunked downloads u, of size bytes, into f over up to conns concurrent
+// Range requests and returns the number of bytes written. It fails when the server
+// does not answer ranges or the file is too small to split, and the caller then
+// downloads in one stream.
+func downloadChunked(ctx context.Context, u string, f *os.File, size int64, conns int) (int64, error) {
+	n := min(int64(conns), size/minChunkSize)
+	if n < 2 {
+		return 0, errors.Errorf("%s is too small to split into %d chunks", formatBytes(size), conns)
+	}
+	if maxMiB := settingsOf(ctx).maxArchiveMiB; maxMiB > 0 && size > int64(maxMiB)<<20 {
+		return 0, errors.Errorf("%s is more than -max-archive-size %d MiB", formatBytes(size), maxMiB)
+	}
+	validator, err := probeRanges(ctx, u, size)
+	if err != nil {
+		return 0, err
+	}
+	if err := f.Truncate(size); err != nil {
+		return 0, err
+	}
+
+	pw := &lockedWriter{w: newProgressWriter(io.Discard, size, nil)}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	chunk := (size + n - 1) / n
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := int64(0); i < n; i++ {
+		start, end := i*chunk, min((i+1)*chunk, size)-1
+		wg.Add(1)
+		go func(i int64) {
+			defer wg.Done()
+			if errs[i] = fetchChunk(ctx, u, f, start, end, validator, pw); errs[i] != nil {
+				// the other chunks are of no use without this one
+				cancel()
+			}
+		}(i)
+	}
+	wg.Wait()
+	pw.w.finish()
+	// report the chunk that failed rather than the ones cancelled because of it
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return 0, err
+		}
+	}
+	for _, err := range errs {
+		if err != nil {
+			return 0, err
+		}
+	}
+	return size, nil
+}
+
+// probeRanges asks u for its first byte and returns the ETag or Last-Modified to
+// send with the chunk requests as If-Range, so that all chunks come from the same
+// file. It fails unless the server answers with the range of a size bytes file.
+func probeRanges(ctx context.Context, u string, size int64) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Range", "bytes=0-0")
+	resp, err := settingsOf(ctx).httpClient().Do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return "", errors.Errorf("%s answered a range request with status %d", u, resp.StatusCode)
+	}
+	if want := fmt.Sprintf("bytes 0-0/%d", size); resp.Header.Get("Content-Range") != want {
+		return "", errors.Errorf("%s answered the range with %q, want %q", u, resp.Header.Get("Content-Range"), want)
+	}
+	v := resp.Header.Get("ETag")
+	if v == "" || strings.HasPrefix(v, "W/") {
+		// weak validators are not allowed in If-Range
+		v = resp.Header.Get("Last-Modified")
+	}
+	if v == "" {
+		return "", errors.Errorf("%s sends neither a strong ETag nor Last-Modified to keep the chunks consistent", u)
+	}
+	return v, nil
+}
+
+// fetchChunk writes the bytes start through end of u to f at their offset,
+// retrying like any other request and continuing after what a failed attempt
+// already wrote.
+func fetchChunk(ctx context.Context, u string, f *os.File, start, end int64, validator string, progress io.Writer) error {
+	done := int64(0)
+	return withRetries(ctx, fmt.Sprintf("%s bytes %d-%d", u, start, end), func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return permanent(err)
+		}
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start+done, end))
+		req.Header.Set("If-Range", validator)
+		resp, err := settingsOf(ctx).httpClient().Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusPartialContent {
+			if resp.StatusCode >= 500 {
+				return &statusError{URL: u, Code: resp.StatusCode}
+			}
+			// a 200 means the file changed since the probe
+			return permanent(errors.Errorf("%s answered the range from byte %d with status %d", u, start+done, resp.StatusCode))
+		}
+		if got, ok := contentRangeStart(resp.Header.Get("Content-Range")); !ok || got != start+done {
+			return permanent(errors.Errorf("%s answered the range from byte %d with %q", u, start+done, resp.Header.Get("Content-Range")))
+		}
+		w := io.MultiWriter(io.NewOffsetWriter(f, start+done), progress)
+		m, err := io.Copy(w, io.LimitReader(resp.Body, end+1-start-done))
+		done += m
+		if err == nil && start+done != end+1 {
+			err = errors.Errorf("%s ended the range %d-%d after %d bytes", u, start, end, done)
+		}
+		return err
+	})
+}
+
+// lockedWriter serializes the writes of concurrent chunks to the progress.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  *progressWriter
+}
+
+func (l *lockedWriter) Write(b []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(b)
+}
@@ -0,0 +1,190 @@
+package godl
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// leftoverAge is how old a temporary download or staging directory must be for
+// cleanup to take it as left behind by a crashed run rather than one in progress.
+const leftoverAge = 24 * time.Hour
+
+// tempDownloadPattern matches the temporary downloads of fetchArchive, the release
+// file name followed by the random suffix of os.CreateTemp.
+var tempDownloadPattern = regexp.MustCompile(`^go[0-9][^/\\]*\.(tar\.gz|zip|msi|pkg)[0-9]+$`)
+
+// cleanupItem is a path cleanup removes.
+type cleanupItem struct {
+	Path string
+	What string
+	Size int64
+}
+
+// cleanup removes the backups of goRoot and the -cache-archives entries that are
+// not among the keep newest and, with olderThan, older than that, along with the
+// temporary downloads and staging directories crashed runs left behind. Backups
+// and cached archives are only removed when keep or olderThan is set. With -dryrun
+// it only prints what it would remove and how much space that reclaims.
+func cleanup(goRoot string, keep int, olderThan time.Duration, now time.Time) error {
+	expired := func(i int, t time.Time) bool {
+		return (keep > 0 || olderThan > 0) && i >= keep && (olderThan == 0 || now.Sub(t) > olderThan)
+	}
+	var items []cleanupItem
+	if goRoot != "" {
+		backups, err := findBackups(goRoot, backupDir, backupRoot)
+		if err != nil {
+			return errors.Wrap(err, "list backups error")
+		}
+		sort.SliceStable(backups, func(i, j int) bool {
+			return versionLess(backups[j].Version, backups[i].Version)
+		})
+		for i, b := range backups {
+			if expired(i, b.Modified) {
+				items = append(items, cleanupItem{Path: b.Path, What: "backup " + b.Version, Size: b.Size})
+			}
+		}
+		staging, err := leftovers(filepath.Dir(goRoot), now, func(name string) bool {
+			return strings.HasPrefix(name, "."+filepath.Base(goRoot)+".staging-")
+		})
+		if err != nil {
+			return err
+		}
+		items = append(items, staging...)
+	}
+	if cacheDir != "" {
+		cached, err := cacheEntries(cacheDir)
+		if err != nil {
+			return errors.Wrap(err, "list cache error")
+		}
+		for i, c := range cached {
+			if expired(i, c.modified) {
+				items = append(items, c.cleanupItem)
+			}
+		}
+	}
+	tmpDirs := []string{os.TempDir()}
+	if workDir != "" && filepath.Clean(workDir) != filepath.Clean(os.TempDir()) {
+		tmpDirs = append(tmpDirs, workDir)
+	}
+	for _, dir := range tmpDirs {
+		tmp, err := leftovers(dir, now, func(name string) bool {
+			return tempDownloadPattern.MatchString(name) || strings.HasPrefix(name, "godl-staging-")
+		})
+		if err != nil {
+			return err
+		}
+		items = append(items, tmp...)
+	}
+
+	var total int64
+	for _, it := range items {
+		if dryRun {
+			fmt.Fprintf(stdout, "would remove %s: %s (%s)\n", it.What, it.Path, formatBytes(it.Size))
+		} else {
+			if err := os.RemoveAll(it.Path); err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "removed %s: %s (%s)\n", it.What, it.Path, formatBytes(it.Size))
+		}
+		total += it.Size
+	}
+	if dryRun {
+		fmt.Fprintf(stdout, "reclaimable: %s in %d items, run with -dryrun=false to remove them\n", formatBytes(total), len(items))
+	} else {
+		fmt.Fprintf(stdout, "reclaimed: %s in %d items\n", formatBytes(total), len(items))
+	}
+	return nil
+}
+
+// cachedEntry is an archive in the -cache-archives directory.
+type cachedEntry struct {
+	cleanupItem
+	modified time.Time
+}
+
+// cacheEntries returns the archives cached in dir, newest first.
+func cacheEntries(dir string) ([]cachedEntry, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cached []cachedEntry
+	for _, e := range entries {
+		name := e.Name()
+		if !e.Type().IsRegular() || len(name) <= sha256HexLen || name[sha256HexLen] != '-' {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		cached = append(cached, cachedEntry{
+			cleanupItem: cleanupItem{Path: filepath.Join(dir, name), What: "cached " + name[sha256HexLen+1:], Size: info.Size()},
+			modified:    info.ModTime(),
+		})
+	}
+	sort.SliceStable(cached, func(i, j int) bool {
+		return cached[i].modified.After(cached[j].modified)
+	})
+	return cached, nil
+}
+
+// leftovers returns the entries of dir whose name match reports and that are
+// older than leftoverAge.
+func leftovers(dir string, now time.Time, match func(name string) bool) ([]cleanupItem, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var items []cleanupItem
+	for _, e := range entries {
+		if !match(e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || now.Sub(info.ModTime()) < leftoverAge {
+			continue
+		}
+		p := filepath.Join(dir, e.Name())
+		it := cleanupItem{Path: p, What: "temporary download", Size: info.Size()}
+		if e.IsDir() {
+			it.What = "staging directory"
+			if it.Size, err = dirSize(p); err != nil {
+				return nil, err
+			}
+		}
+		items = append(items, it)
+	}
+	return items, nil
+}
+
+// parseAge parses -older-than, a duration such as 720h or a number of days
+// such as 30d.
+func parseAge(v string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, errors.Errorf("invalid -older-than %q", v)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, errors.Errorf("invalid -older-than %q, want a duration such as 720h or days such as 30d", v)
+	}
+	return d, nil
+}
@@ -0,0 +1,222 @@
+package godl
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// args are the positional arguments left once the subcommand and the flags
+// following it are parsed.
+var args []string
+
+// removeTarget and useTarget are the versions the remove and use subcommands
+// delete and switch to.
+var removeTarget, useTarget string
+
+// cleanupRun, checkRun, bundleRun, configRun, verifyRun, envRun and watchRun are
+// set by the cleanup, check, bundle, config, verify, env and watch subcommands.
+var cleanupRun, checkRun, bundleRun, configRun, verifyRun, envRun, watchRun bool
+
+// completionShell is the shell of the completion subcommand, and completeFor the
+// subcommand whose versions the hidden __complete command lists.
+var completionShell, completeFor string
+
+// subcommands are the first arguments that select what godl does; each is a
+// shorthand for the flags of that mode.
+var subcommands = map[string]string{
+	"bundle":     "write the newest or the given version and its release metadata to a tar (-o file.tar) for install -from-bundle on offline machines",
+	"check":      "only report whether a newer release, or the version pinned by .go-version or go.mod, differs from the installed one, exiting with -update-exit-code and notifying -webhook if so",
+	"cleanup":    "remove old backups (-keep, -older-than), cached archives and the leftovers of crashed runs; honors -dryrun",
+	"completion": "print the completion script for bash, zsh, fish or powershell, e.g. source <(godl completion bash)",
+	"config":     "print the resolved settings, or get, set or unset one in the config file ($GODL_CONFIG, default ~/.config/godl/config.toml)",
+	"list":       "list the releases available for this platform, like -list",
+	"env":        "print the lines selecting the current toolchain for sh (the default), fish or powershell, for eval \"$(godl env)\" in a shell profile",
+	"download":   "save the newest or the given version to -download-dir, for any -os and -arch, like -download-only",
+	"install":    "install the given version, like -version, without one the version pinned by .go-version or go.mod, or with -versions-dir the given versions",
+	"update":     "upgrade GOROOT to the newest release, the default",
+	"rollback":   "swap GOROOT with its newest backup, like -rollback",
+	"watch":      "keep running, polling every -poll-interval for a new release, prefetching and verifying it into -cache-archives and then notifying or installing it by -watch-policy",
+	"verify":     "check the files of GOROOT against the manifest recorded when godl installed it, or the official archive like -audit, and fail on modified, missing or extra files",
+	"remove":     "delete the backup or -versions-dir installation of the given version",
+	"use":        "point the current symlink of -versions-dir at the given installed version",
+}
+
+// usage prints the subcommands and the flags.
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "usage: %s [subcommand] [flags] [arguments]\n\nsubcommands:\n", filepath.Base(os.Args[0]))
+	names := make([]string, 0, len(subcommands))
+	for name := range subcommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(out, "  %-10s %s\n", name, subcommands[name])
+	}
+	fmt.Fprintln(out, "\nflags:")
+	flag.PrintDefaults()
+}
+
+// parseSubcommand applies the subcommand named by the first argument, if any, and
+// parses the flags given after it. Without a subcommand the arguments are left to
+// the modes reading them, -compare and -versions-dir.
+func parseSubcommand() error {
+	args = flag.Args()
+	if len(args) == 0 {
+		return nil
+	}
+	cmd := args[0]
+	if cmd == completeCommand && len(args) == 2 {
+		completeFor, args = args[1], nil
+		return nil
+	}
+	if _, ok := subcommands[cmd]; !ok {
+		return nil
+	}
+	// flags may follow the subcommand and be mixed with its arguments
+	var pos []string
+	rest := args[1:]
+	for {
+		if err := flag.CommandLine.Parse(rest); err != nil {
+			return err
+		}
+		if flag.NArg() == 0 {
+			break
+		}
+		pos = append(pos, flag.Arg(0))
+		rest = flag.Args()[1:]
+	}
+	args = pos
+
+	want := 0
+	switch cmd {
+	case "list":
+		list = true
+	case "rollback":
+		rollback = true
+	case "cleanup":
+		cleanupRun = true
+	case "check":
+		checkRun = true
+	case "verify":
+		verifyRun = true
+	case "watch":
+		watchRun = true
+	case "completion":
+		if len(pos) != 1 {
+			return errors.Errorf("usage: godl completion %s", strings.Join(completionShells, "|"))
+		}
+		completionShell = pos[0]
+		return nil
+	case "env":
+		envRun = true
+		if len(pos) > 1 {
+			return errors.Errorf("usage: godl env [%s]", strings.Join(envShells, "|"))
+		}
+		return nil
+	case "config":
+		configRun = true
+		n := map[string]int{"get": 2, "set": 3, "unset": 2, "path": 1}
+		if len(pos) > 0 && n[pos[0]] != len(pos) {
+			return errors.New("usage: godl config [get <key> | set <key> <value> | unset <key> | path]")
+		}
+		return nil
+	case "install":
+		if fromBundle != "" && len(pos) == 0 {
+			// the version defaults to the one in the bundle
+			return nil
+		}
+		if versionsDir == "" && len(pos) == 0 && wantVersion == "" {
+			// the version the project pins
+			useGoVersion = true
+			return nil
+		}
+		if versionsDir != "" {
+			if len(pos) == 0 {
+				return errors.New("usage: godl install -versions-dir dir <version>...")
+			}
+			return nil
+		}
+		want = 1
+	case "remove", "use":
+		want = 1
+	case "download", "bundle":
+		downloadOnly = true
+		bundleRun = cmd == "bundle"
+		if len(pos) > 1 {
+			return errors.Errorf("usage: godl %s [flags] [version]", cmd)
+		}
+		want = len(pos)
+	}
+	if len(pos) != want {
+		if want == 1 {
+			return errors.Errorf("usage: godl %s <version>", cmd)
+		}
+		return errors.Errorf("godl %s takes no arguments", cmd)
+	}
+	if want == 1 {
+		v := pos[0]
+		if !strings.HasPrefix(v, "go") {
+			v = "go" + v
+		}
+		switch cmd {
+		case "install", "download", "bundle":
+			wantVersion = v
+		case "remove":
+			removeTarget = v
+		case "use":
+			useTarget = v
+		}
+		args = nil
+	}
+	return nil
+}
+
+// removeVersion deletes the installations of version that are not in use: the
+// -versions-dir tree of that version and the backups of goRoot holding it.
+func removeVersion(goRoot, version string) error {
+	var paths []string
+	if versionsDir != "" {
+		p := filepath.Join(versionsDir, version)
+		if cur, err := os.Readlink(filepath.Join(versionsDir, currentLink)); err == nil && cur == version {
+			return errors.Errorf("%s is in use through %s, switch to another version first", version, filepath.Join(versionsDir, currentLink))
+		}
+		if v, err := readVersionFile(p); err == nil && v == version {
+			paths = append(paths, p)
+		}
+	}
+	if goRoot != "" {
+		backups, err := findBackups(goRoot, backupDir, backupRoot)
+		if err != nil {
+			return errors.Wrap(err, "list backups error")
+		}
+		for _, b := range backups {
+			if b.Version == version {
+				paths = append(paths, b.Path)
+			}
+		}
+	}
+	if len(paths) == 0 {
+		if v, err := readVersionFile(goRoot); goRoot != "" && err == nil && v == version {
+			return errors.Errorf("%s is the version in GOROOT %s, which remove never deletes", version, goRoot)
+		}
+		return errors.Errorf("no backup or -versions-dir installation of %s found", version)
+	}
+	for _, p := range paths {
+		if dryRun {
+			fmt.Fprintf(stdout, "would remove %s\n", p)
+			continue
+		}
+		if err := os.RemoveAll(p); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "removed: %s\n", p)
+	}
+	return nil
+}
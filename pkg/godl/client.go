@@ -0,0 +1,233 @@
+package godl
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Client lists, resolves, downloads and installs the releases of one Source, for
+// programs embedding godl rather than running the command. The zero Client uses
+// go.dev, neither retries nor caches and prints and logs nothing. None of its
+// settings are taken from the command's flags, and its requests go through the
+// transport of net/http even when the command configured its own.
+type Client struct {
+	// Source is where the releases and their files come from, go.dev when zero.
+	Source Source
+	// Output receives human readable progress, such as the URLs downloaded from.
+	Output io.Writer
+	// CacheDir keeps the downloaded archives and reuses them, like -cache-archives.
+	CacheDir string
+	// MetadataCacheDir keeps the release lists and revalidates them, like
+	// -metadata-cache; copies younger than MetadataTTL are used as they are.
+	MetadataCacheDir string
+	MetadataTTL      time.Duration
+	// Retries is how often a request failing with a network error or a 5xx status
+	// is repeated, like -retries.
+	Retries int
+	// AttemptTimeout bounds each attempt of a request, like -timeout-per-retry; 0
+	// means no limit beyond the deadline of the context.
+	AttemptTimeout time.Duration
+	// NoResume starts a retried download over instead of continuing it with a
+	// Range request, like -resume=false.
+	NoResume bool
+	// MaxArchiveMiB refuses release files larger than this many MiB, like
+	// -max-archive-size; 0 means no limit.
+	MaxArchiveMiB int
+	// AllowMissingChecksum accepts files the release list publishes no SHA-256
+	// for, which are otherwise refused because nothing could verify them.
+	AllowMissingChecksum bool
+	// Logger receives the warnings, such as retried requests, and the records of
+	// the downloads and installs; nil discards them.
+	Logger *slog.Logger
+}
+
+// context returns ctx with the settings of c.
+func (c *Client) context(ctx context.Context) context.Context {
+	log := c.Logger
+	if log == nil {
+		log = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	return withSettings(ctx, transferSettings{
+		retries:        c.Retries,
+		maxArchiveMiB:  c.MaxArchiveMiB,
+		attemptTimeout: c.AttemptTimeout,
+		resume:         !c.NoResume,
+		metaCacheDir:   c.MetadataCacheDir,
+		metaCacheTTL:   c.MetadataTTL,
+		out:            c.output(),
+		log:            log,
+		client:         true,
+	})
+}
+
+// output returns c.Output, or io.Discard when it is nil.
+func (c *Client) output() io.Writer {
+	if c.Output == nil {
+		return io.Discard
+	}
+	return c.Output
+}
+
+// checkSum compares the SHA-256 sum computed of file with the published one.
+func (c *Client) checkSum(file File, sum string) error {
+	if file.Sha256 != "" && !strings.EqualFold(sum, file.Sha256) {
+		return withKind(ErrChecksumMismatch, errors.Errorf("sha256 mismatch: got %s, want %s", sum, file.Sha256))
+	}
+	return nil
+}
+
+// checkPublished refuses file when it has no SHA-256 to check it against.
+func (c *Client) checkPublished(file File) error {
+	if file.Sha256 == "" && !c.AllowMissingChecksum {
+		return errors.Errorf("the release list has no sha256 for %s, refusing it without AllowMissingChecksum", file.Filename)
+	}
+	return nil
+}
+
+// ListReleases returns every published release, newest first.
+func (c *Client) ListReleases(ctx context.Context) ([]Release, error) {
+	return Releases(c.context(ctx), ReleaseOptions{Source: c.Source, All: true, Channel: "all"})
+}
+
+// Resolve returns the release constraint selects, in any form -version accepts:
+// an exact version such as go1.21.13, a line such as go1.21 or 1.22.x, or a
+// constraint such as ">=1.21 <1.23". Lines and constraints pick the newest
+// stable release matching them.
+func (c *Client) Resolve(ctx context.Context, constraint string) (Release, error) {
+	rs, err := c.ListReleases(ctx)
+	if err != nil {
+		return Release{}, err
+	}
+	v, err := resolveVersion(rs, constraint)
+	if err != nil {
+		return Release{}, err
+	}
+	for _, r := range rs {
+		if r.Version == v {
+			return r, nil
+		}
+	}
+	return Release{}, errors.Errorf("%s not found in the release list", v)
+}
+
+// Archive returns the archive of r for goos/goarch, the platform of this machine
+// when empty.
+func (c *Client) Archive(r Release, goos, goarch string) (File, error) {
+	if goos == "" || goarch == "" {
+		goos, goarch = HostPlatform()
+	}
+	goarch = releaseArch(goarch)
+	for _, f := range r.Files {
+		if f.Kind == "archive" && f.Os == goos && f.Arch == goarch {
+			return f, nil
+		}
+	}
+	return File{}, withKind(ErrNoMatchingPlatform, errors.Errorf("%s has no archive for %s/%s", r.Version, goos, goarch))
+}
+
+// Download writes file to w and checks it against the SHA-256 of the release
+// list; w has all of the file when the error is nil, or the digest did not match.
+// A file without a published SHA-256 is refused before anything is downloaded,
+// unless c.AllowMissingChecksum is set.
+func (c *Client) Download(ctx context.Context, file File, w io.Writer) (int64, error) {
+	if err := c.checkPublished(file); err != nil {
+		return 0, err
+	}
+	h := sha256.New()
+	n, err := Download(c.context(ctx), file, io.MultiWriter(w, h), DownloadOptions{Source: c.Source, Progress: func(int64, int64) {}})
+	if err != nil {
+		return n, err
+	}
+	return n, c.checkSum(file, hex.EncodeToString(h.Sum(nil)))
+}
+
+// Install downloads and verifies the archive file and installs it into
+// opts.GoRoot. An existing installation is replaced by Install, a missing one is
+// created. opts.StagingDir is ignored, the archive is staged next to GoRoot.
+func (c *Client) Install(ctx context.Context, file File, opts InstallOptions) (InstallResult, error) {
+	res := InstallResult{Version: fileVersion(file), GoRoot: opts.GoRoot}
+	if file.Kind != "archive" {
+		return res, errors.Errorf("%s is not an archive", file.Filename)
+	}
+	if err := c.checkPublished(file); err != nil {
+		return res, err
+	}
+	src := c.Source
+	if src.isZero() {
+		src = defaultSource
+	}
+	out := c.output()
+	ctx = c.context(ctx)
+	archive, temp, err := fetchArchiveWith(ctx, src, file, archiveOptions{out: out, cacheDir: c.CacheDir, progress: func(int64, int64) {}})
+	if temp {
+		defer os.Remove(archive)
+	}
+	if err != nil {
+		return res, err
+	}
+	sum, err := hashFile(archive)
+	if err == nil {
+		err = c.checkSum(file, sum)
+	}
+	if err != nil {
+		return res, errors.Wrap(err, file.Filename)
+	}
+	extractDir, staged, err := stageArchive(ctx, file, archive, opts.GoRoot)
+	if extractDir != "" {
+		defer os.RemoveAll(extractDir)
+	}
+	if err != nil {
+		return res, err
+	}
+	if _, err := os.Lstat(opts.GoRoot); os.IsNotExist(err) {
+		verify := opts.Verify
+		if verify == nil {
+			verify = func(string) error { return nil }
+		}
+		if err := installFresh(ctx, staged, opts.GoRoot, verify); err != nil {
+			return res, err
+		}
+		fmt.Fprintf(out, "installed: %s\n", opts.GoRoot)
+		res.Installed = true
+		return res, nil
+	}
+	opts.StagingDir = staged
+	if opts.PreviousVersion == "" {
+		opts.PreviousVersion, _ = readVersionFile(opts.GoRoot)
+	}
+	return Install(ctx, file, opts)
+}
+
+// stageArchive extracts the verified archive of file into a new staging directory
+// next to goRoot and returns that directory, for the caller to remove, and the
+// toolchain tree within it.
+func stageArchive(ctx context.Context, file File, archive, goRoot string) (extractDir, staged string, err error) {
+	parent := filepath.Dir(goRoot)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return "", "", err
+	}
+	extractDir, err = os.MkdirTemp(parent, "."+filepath.Base(goRoot)+".staging-")
+	if err != nil {
+		return "", "", err
+	}
+	r, err := os.Open(archive)
+	if err != nil {
+		return extractDir, "", err
+	}
+	defer r.Close()
+	opts := ExtractOptions{PreserveMode: true, Prefix: archiveRoot, Logger: settingsOf(ctx).log}
+	if err := ExtractArchive(r, file.Filename, extractDir, opts); err != nil {
+		return extractDir, "", errors.Wrap(err, "extract error")
+	}
+	return extractDir, filepath.Join(extractDir, archiveRoot), nil
+}
@@ -0,0 +1,148 @@
+package godl
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClientDownloadNeedsChecksum(t *testing.T) {
+	testSettings(t)
+	srv := newFakeServer(t, "go1.22.1")
+	file := srv.file("go1.22.1")
+	file.Sha256 = ""
+
+	var buf bytes.Buffer
+	c := &Client{Source: srv.source()}
+	if _, err := c.Download(context.Background(), file, &buf); err == nil {
+		t.Fatal("downloaded a file without a published sha256")
+	}
+	if _, err := c.Install(context.Background(), file, InstallOptions{GoRoot: filepath.Join(t.TempDir(), "go")}); err == nil {
+		t.Fatal("installed a file without a published sha256")
+	}
+	if n := srv.downloads.Load(); n != 0 {
+		t.Errorf("%d downloads of a file that is refused, want 0", n)
+	}
+
+	c.AllowMissingChecksum = true
+	if _, err := c.Download(context.Background(), file, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), srv.files[file.Filename]) {
+		t.Error("downloaded other content than served")
+	}
+}
+
+func TestClientIgnoresFlags(t *testing.T) {
+	out := testSettings(t)
+	srv := newFakeServer(t, "go1.22.1")
+	file := srv.file("go1.22.1")
+	// settings of the command that must not leak into the client
+	flagCache := t.TempDir()
+	set(t, &cacheDir, flagCache)
+	set(t, &maxArchiveMiB, 1)
+	set(t, &retries, 0)
+	file.Size = 2 << 20
+	tooLarge := file
+	file = srv.file("go1.22.1")
+
+	var progress bytes.Buffer
+	c := &Client{Source: srv.source(), Output: &progress, CacheDir: t.TempDir()}
+	goRoot := filepath.Join(t.TempDir(), "go")
+	if _, err := c.Install(context.Background(), file, InstallOptions{GoRoot: goRoot}); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := readVersionFile(goRoot); err != nil || v != "go1.22.1" {
+		t.Errorf("%s has %q, %v, want go1.22.1", goRoot, v, err)
+	}
+	if !strings.Contains(progress.String(), "downloading: ") {
+		t.Errorf("client output %q, want the download", progress.String())
+	}
+	if out.Len() != 0 {
+		t.Errorf("the client wrote %q to the command's output", out)
+	}
+	if entries, _ := os.ReadDir(flagCache); len(entries) != 0 {
+		t.Error("the client stored the archive in -cache-archives")
+	}
+	if _, ok := cachedArchive(c.CacheDir, file); !ok {
+		t.Error("the archive is not in the client's cache")
+	}
+
+	// the release list size is checked against the client's limit only
+	var buf bytes.Buffer
+	if _, err := c.Download(context.Background(), tooLarge, &buf); err == nil || strings.Contains(err.Error(), "max-archive-size") {
+		t.Errorf("downloading a 2 MiB file without a limit: %v, want the size mismatch", err)
+	}
+	c.MaxArchiveMiB = 1
+	if _, err := c.Download(context.Background(), tooLarge, &buf); err == nil || !strings.Contains(err.Error(), "max-archive-size") {
+		t.Errorf("downloading a 2 MiB file with a 1 MiB limit: %v, want it refused", err)
+	}
+}
+
+func TestClientIgnoresTransportAndLogging(t *testing.T) {
+	testSettings(t)
+	srv := newFakeServer(t, "go1.22.1")
+	// the first request for the release list fails and is retried
+	var failed atomic.Bool
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/dl/") && !failed.Swap(true) {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		srv.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer flaky.Close()
+	src := srv.source()
+	for _, u := range []*string{&src.ReleasesURL, &src.AllReleasesURL, &src.DownloadURL} {
+		*u = strings.Replace(*u, srv.URL, flaky.URL, 1)
+	}
+
+	// the command's transport goes through a proxy that is not there
+	transport, checkRedirect := http.DefaultTransport, http.DefaultClient.CheckRedirect
+	t.Cleanup(func() { http.DefaultTransport, http.DefaultClient.CheckRedirect = transport, checkRedirect })
+	set(t, &proxyURL, "http://127.0.0.1:1")
+	if err := configureTransport(); err != nil {
+		t.Fatal(err)
+	}
+	flagCache := t.TempDir()
+	set(t, &metaCacheDir, flagCache)
+	set(t, &attemptTimeout, time.Nanosecond)
+	var runLog, clientLog bytes.Buffer
+	set(t, &logger, slog.New(slog.NewTextHandler(&runLog, nil)))
+
+	c := &Client{Source: src, Retries: 1, Logger: slog.New(slog.NewTextHandler(&clientLog, nil))}
+	r, err := c.Resolve(context.Background(), "go1.22")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := c.Archive(r, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	goRoot := filepath.Join(t.TempDir(), "go")
+	if _, err := c.Install(context.Background(), file, InstallOptions{GoRoot: goRoot}); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := readVersionFile(goRoot); err != nil || v != "go1.22.1" {
+		t.Errorf("%s has %q, %v, want go1.22.1", goRoot, v, err)
+	}
+	if entries, _ := os.ReadDir(flagCache); len(entries) != 0 {
+		t.Error("the client stored the release list in -metadata-cache")
+	}
+	if runLog.Len() != 0 {
+		t.Errorf("the client logged %q to the logger of the run", runLog.String())
+	}
+	for _, want := range []string{"retrying", "downloaded"} {
+		if !strings.Contains(clientLog.String(), want) {
+			t.Errorf("client log %q, want %q", clientLog.String(), want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package godl
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	colorRed    = "31"
+	colorGreen  = "32"
+	colorYellow = "33"
+)
+
+func validateColorMode() error {
+	switch colorMode {
+	case "auto", "always", "never":
+		return nil
+	}
+	return errors.Errorf("invalid -color value %q, want auto, always or never", colorMode)
+}
+
+// useColor reports whether decorative output written to f may use escape codes.
+// An explicit -color always or never wins, otherwise color is used only on a
+// terminal and only when NO_COLOR is not set.
+func useColor(f *os.File) bool {
+	switch colorMode {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return isTerminal(f.Fd())
+}
+
+// colorize wraps s in the SGR color code when f accepts color.
+func colorize(f *os.File, color, s string) string {
+	if !useColor(f) {
+		return s
+	}
+	return "\x1b[" + color + "m" + s + "\x1b[0m"
+}
+
+// warnf prints a warning line to stderr, highlighted when stderr accepts color, or
+// logs it as a record when the records are JSON. -quiet holds it back.
+func warnf(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	if jsonLogs() {
+		logger.Warn(msg)
+		return
+	}
+	if !quiet {
+		fmt.Fprintln(os.Stderr, colorize(os.Stderr, colorYellow, msg))
+	}
+	if fileLog != nil {
+		fileLog.Warn(msg)
+	}
+}
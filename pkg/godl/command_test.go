@@ -0,0 +1,162 @@
+package godl
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// panicVerifier panics like a bug in a verification step would.
+type panicVerifier struct{}
+
+func (panicVerifier) Verify(File, string) error {
+	var files []File
+	_ = files[3]
+	return nil
+}
+
+func TestSafeRunPanicCleansUp(t *testing.T) {
+	out := testSettings(t)
+	newFakeServer(t, "go1.21.5", "go1.22.1")
+	goRoot := setupGoRoot(t, "go1.21.5")
+	// the download and the staging tree go here
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	set(t, &staging, "tmp")
+	set(t, &verifiers, []Verifier{panicVerifier{}})
+
+	err := safeRun(context.Background())
+	if err == nil {
+		t.Fatalf("a panicking run succeeded\n%s", out)
+	}
+	if !strings.HasPrefix(err.Error(), "panic: ") || !strings.Contains(err.Error(), "panicVerifier.Verify") {
+		t.Errorf("the error does not carry the panic and its stack: %v", err)
+	}
+	if entries, _ := os.ReadDir(tmp); len(entries) != 0 {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Errorf("left behind after the panic: %v", names)
+	}
+	if v, _ := readVersionFile(goRoot); v != "go1.21.5" {
+		t.Errorf("GOROOT has %s after the panic, want go1.21.5", v)
+	}
+}
+
+func TestParseGoVersionWindows(t *testing.T) {
+	for _, out := range []string{
+		"go version go1.22.2 windows/amd64\r\n",
+		"go version go1.22.2 windows/amd64\r",
+		"go version go1.22.2 windows/amd64 \r\n\r\n",
+		"\r\ngo version\tgo1.22.2  windows/amd64\r\n",
+	} {
+		iv, err := parseGoVersion(out)
+		want := InstalledVersion{Os: "windows", Arch: "amd64", Version: "go1.22.2"}
+		if err != nil || iv != want {
+			t.Errorf("parseGoVersion(%q) = %+v, %v, want %+v", out, iv, err, want)
+		}
+	}
+}
+
+func TestParseGoVersion(t *testing.T) {
+	for _, tt := range []struct {
+		out  string
+		want InstalledVersion
+	}{
+		{"go version go1.22.2 linux/amd64\n", InstalledVersion{Os: "linux", Arch: "amd64", Version: "go1.22.2"}},
+		{"go version go1.23rc1 darwin/arm64", InstalledVersion{Os: "darwin", Arch: "arm64", Version: "go1.23rc1"}},
+		{"  go   version  go1.21.0   freebsd/386  \n", InstalledVersion{Os: "freebsd", Arch: "386", Version: "go1.21.0"}},
+		{"go version devel go1.24-abc123 Tue Oct 1 10:00:00 2024 +0000 linux/amd64\n", InstalledVersion{Os: "linux", Arch: "amd64", Version: "go1.24-abc123"}},
+		{"go version go1.22.2 X:boringcrypto linux/amd64\n", InstalledVersion{Os: "linux", Arch: "amd64", Version: "go1.22.2"}},
+	} {
+		got, err := parseGoVersion(tt.out)
+		if err != nil || got != tt.want {
+			t.Errorf("parseGoVersion(%q) = %+v, %v, want %+v", tt.out, got, err, tt.want)
+		}
+	}
+	for _, out := range []string{
+		"",
+		"go",
+		"go version",
+		"go version go1.22.2",
+		"go version devel linux/amd64",
+		"gccgo version 12 linux/amd64",
+		"go version 1.22.2 linux/amd64",
+		"go version go1.22.2 linux",
+		"go version go1.22.2 linux/",
+		"go version go1.22.2 /amd64",
+		"go version go1.22.2 linux/amd64/extra",
+	} {
+		if got, err := parseGoVersion(out); err == nil {
+			t.Errorf("parseGoVersion(%q) = %+v, want an error", out, got)
+		}
+	}
+}
+
+func TestCompleteReportsBadSource(t *testing.T) {
+	testSettings(t)
+	set(t, &completeFor, "install")
+	set(t, &mirror, "nowhere")
+	if err := safeRun(context.Background()); err == nil || !strings.Contains(err.Error(), "-mirror") {
+		t.Errorf("completing with an invalid -mirror: %v, want the -mirror error", err)
+	}
+}
+
+func TestRunWaitsForLockBeforeVersionCheck(t *testing.T) {
+	out := testSettings(t)
+	srv := newFakeServer(t, "go1.21.5", "go1.22.1")
+	goRoot := setupGoRoot(t, "go1.21.5")
+	backup := filepath.Join(filepath.Dir(goRoot), "go@go1.20.14")
+	if err := os.MkdirAll(backup, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(backup, "VERSION"), []byte("go1.20.14\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// old enough for the cleanup below
+	if err := markBackup(backup, time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	// another run is installing
+	unlock, err := acquireLock(context.Background(), lockPath(goRoot), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+	set(t, &lockTimeout, "50ms")
+
+	if err := safeRun(context.Background()); err == nil || !strings.Contains(err.Error(), "lock") {
+		t.Fatalf("install while locked: %v, want a lock error\n%s", err, out)
+	}
+	if n := srv.downloads.Load(); n != 0 {
+		t.Errorf("%d downloads before the lock was taken, want 0", n)
+	}
+	set(t, &removeTarget, "go1.20.14")
+	if err := safeRun(context.Background()); err == nil || !strings.Contains(err.Error(), "lock") {
+		t.Errorf("remove while locked: %v, want a lock error", err)
+	}
+	removeTarget = ""
+	set(t, &cleanupRun, true)
+	set(t, &keepBackups, 0)
+	set(t, &olderThan, "1s")
+	if err := safeRun(context.Background()); err == nil || !strings.Contains(err.Error(), "lock") {
+		t.Errorf("cleanup while locked: %v, want a lock error", err)
+	}
+	if _, err := os.Stat(backup); err != nil {
+		t.Errorf("the backup was removed under the lock of another run: %v", err)
+	}
+
+	// once the other run is done, the install goes ahead
+	unlock()
+	cleanupRun = false
+	if err := safeRun(context.Background()); err != nil {
+		t.Fatalf("install: %v\n%s", err, out)
+	}
+	if v, _ := readVersionFile(goRoot); v != "go1.22.1" {
+		t.Errorf("GOROOT has %s, want go1.22.1", v)
+	}
+}
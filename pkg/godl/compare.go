@@ -0,0 +1,138 @@
+package godl
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// compareToolchains prints the release metadata of versions a and b for the host
+// platform and, when both trees are present locally, how their file lists differ.
+func compareToolchains(ctx context.Context, src Source, iv InstalledVersion, goRoot, a, b string) error {
+	rs, err := Releases(ctx, ReleaseOptions{Source: src, All: true, Channel: "all", OS: iv.Os, Arch: iv.Arch})
+	if err != nil {
+		return err
+	}
+	for _, v := range []string{a, b} {
+		file, ok := findFile(rs, v, kind)
+		if !ok {
+			fmt.Fprintf(stdout, "%-12s not found for %s/%s\n", v, iv.Os, iv.Arch)
+			continue
+		}
+		fmt.Fprintf(stdout, "%-12s %s %d bytes\n", v, file.Filename, file.Size)
+	}
+
+	roots := []string{filepath.Dir(goRoot)}
+	if backupRoot != "" {
+		roots = append(roots, backupRoot)
+	}
+	treeA, okA := findToolchain(roots, a)
+	treeB, okB := findToolchain(roots, b)
+	if !okA || !okB {
+		fmt.Fprintln(stdout, "both toolchains must be installed or backed up locally to compare their files")
+		return nil
+	}
+	filesA, err := treeFiles(treeA)
+	if err != nil {
+		return err
+	}
+	filesB, err := treeFiles(treeB)
+	if err != nil {
+		return err
+	}
+	var onlyA, onlyB, changed int
+	for p, size := range filesA {
+		if sizeB, ok := filesB[p]; !ok {
+			onlyA++
+		} else if sizeB != size {
+			changed++
+		}
+	}
+	for p := range filesB {
+		if _, ok := filesA[p]; !ok {
+			onlyB++
+		}
+	}
+	fmt.Fprintf(stdout, "%s: %s, %d files\n", a, treeA, len(filesA))
+	fmt.Fprintf(stdout, "%s: %s, %d files\n", b, treeB, len(filesB))
+	fmt.Fprintf(stdout, "only in %s: %d, only in %s: %d, size changed: %d\n", a, onlyA, b, onlyB, changed)
+	return nil
+}
+
+// findFile returns the file of the given kind of release version.
+func findFile(rs []Release, version, kind string) (File, bool) {
+	for _, r := range rs {
+		if r.Version != version {
+			continue
+		}
+		for _, f := range r.Files {
+			if kind == "" || f.Kind == kind {
+				return f, true
+			}
+		}
+	}
+	return File{}, false
+}
+
+// findToolchain looks for a Go tree of version directly under one of roots, going
+// by the first line of its VERSION file.
+func findToolchain(roots []string, version string) (string, bool) {
+	for _, root := range roots {
+		entries, err := os.ReadDir(root)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if !e.IsDir() {
+				continue
+			}
+			dir := filepath.Join(root, e.Name())
+			if v, err := readVersionFile(dir); err == nil && v == version {
+				return dir, true
+			}
+		}
+	}
+	return "", false
+}
+
+// readVersionFile returns the version recorded in the VERSION file of a Go tree.
+func readVersionFile(dir string) (string, error) {
+	f, err := os.Open(filepath.Join(dir, "VERSION"))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	if !s.Scan() {
+		return "", errors.Errorf("empty VERSION file in %s", dir)
+	}
+	return strings.TrimSpace(s.Text()), nil
+}
+
+// treeFiles returns the size of every regular file under dir keyed by its slash
+// separated path relative to dir.
+func treeFiles(dir string) (map[string]int64, error) {
+	files := make(map[string]int64)
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = info.Size()
+		return nil
+	})
+	return files, err
+}
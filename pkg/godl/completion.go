@@ -0,0 +1,257 @@
+package godl
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/execabs"
+)
+
+// completeCommand is the hidden first argument the completion scripts call back
+// with, followed by the subcommand whose version argument is completed.
+const completeCommand = "__complete"
+
+// versionCommands are the subcommands that take a version argument.
+var versionCommands = []string{"install", "download", "bundle", "use", "remove"}
+
+// completionShells and envShells are the shells completion and env write for.
+var (
+	completionShells = []string{"bash", "zsh", "fish", "powershell"}
+	envShells        = []string{"sh", "fish", "powershell"}
+)
+
+// writeCompletion writes the completion script for shell to w. The subcommands
+// and flags are spelled out in the script; the versions are asked from godl
+// __complete as they are completed.
+func writeCompletion(w io.Writer, shell string) error {
+	var names []string
+	for name := range subcommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var flags []string
+	flag.VisitAll(func(f *flag.Flag) { flags = append(flags, "-"+f.Name) })
+	versioned := strings.Join(versionCommands, " ")
+
+	var b strings.Builder
+	switch shell {
+	case "bash":
+		fmt.Fprintf(&b, `# bash completion for godl, load it with: source <(godl completion bash)
+_godl() {
+	local cur=${COMP_WORDS[COMP_CWORD]} cmd="" i
+	for ((i = 1; i < COMP_CWORD; i++)); do
+		case ${COMP_WORDS[i]} in
+		-*) ;;
+		*) cmd=${COMP_WORDS[i]}; break ;;
+		esac
+	done
+	if [[ $cur == -* ]]; then
+		COMPREPLY=($(compgen -W "%s" -- "$cur"))
+	elif [[ -z $cmd ]]; then
+		COMPREPLY=($(compgen -W "%s" -- "$cur"))
+	else
+		case $cmd in
+		%s) COMPREPLY=($(compgen -W "$(godl %s "$cmd" 2>/dev/null)" -- "$cur")) ;;
+		completion) COMPREPLY=($(compgen -W "%s" -- "$cur")) ;;
+		env) COMPREPLY=($(compgen -W "%s" -- "$cur")) ;;
+		esac
+	fi
+}
+complete -F _godl godl
+`, strings.Join(flags, " "), strings.Join(names, " "), strings.Join(versionCommands, "|"), completeCommand,
+			strings.Join(completionShells, " "), strings.Join(envShells, " "))
+	case "zsh":
+		var described []string
+		for _, name := range names {
+			described = append(described, shellQuote(name+":"+strings.ReplaceAll(subcommands[name], ":", `\:`)))
+		}
+		fmt.Fprintf(&b, `#compdef godl
+# zsh completion for godl, load it with: source <(godl completion zsh)
+_godl() {
+	local -a subcommands
+	subcommands=(%s)
+	if [[ $words[CURRENT] == -* ]]; then
+		compadd -- %s
+	elif (( CURRENT == 2 )); then
+		_describe 'subcommand' subcommands
+	else
+		case $words[2] in
+		%s) compadd -- ${(f)"$(godl %s $words[2] 2>/dev/null)"} ;;
+		completion) compadd -- %s ;;
+		env) compadd -- %s ;;
+		esac
+	fi
+}
+compdef _godl godl
+`, strings.Join(described, " "), strings.Join(flags, " "), strings.Join(versionCommands, "|"), completeCommand,
+			strings.Join(completionShells, " "), strings.Join(envShells, " "))
+	case "fish":
+		b.WriteString("# fish completion for godl, load it with: godl completion fish | source\ncomplete -c godl -f\n")
+		for _, name := range names {
+			fmt.Fprintf(&b, "complete -c godl -n __fish_use_subcommand -a %s -d %s\n", name, fishQuote(subcommands[name]))
+		}
+		flag.VisitAll(func(f *flag.Flag) {
+			fmt.Fprintf(&b, "complete -c godl -o %s -d %s\n", f.Name, fishQuote(firstSentence(f.Usage)))
+		})
+		fmt.Fprintf(&b, "complete -c godl -n '__fish_seen_subcommand_from %s' -a '(godl %s (commandline -opc)[2] 2>/dev/null)'\n", versioned, completeCommand)
+		fmt.Fprintf(&b, "complete -c godl -n '__fish_seen_subcommand_from completion' -a '%s'\n", strings.Join(completionShells, " "))
+		fmt.Fprintf(&b, "complete -c godl -n '__fish_seen_subcommand_from env' -a '%s'\n", strings.Join(envShells, " "))
+	case "powershell":
+		fmt.Fprintf(&b, `# PowerShell completion for godl, load it with: godl completion powershell | Out-String | Invoke-Expression
+Register-ArgumentCompleter -Native -CommandName godl -ScriptBlock {
+	param($wordToComplete, $commandAst, $cursorPosition)
+	$words = @($commandAst.CommandElements | ForEach-Object { $_.ToString() } | Where-Object { $_ -notlike '-*' })
+	if ($wordToComplete -like '-*') {
+		$candidates = @(%s)
+	} elseif ($words.Count -le 1 -or ($words.Count -eq 2 -and $wordToComplete)) {
+		$candidates = @(%s)
+	} else {
+		switch ($words[1]) {
+			{ $_ -in @(%s) } { $candidates = @(& godl %s $words[1] 2>$null) }
+			'completion' { $candidates = @(%s) }
+			'env' { $candidates = @(%s) }
+			default { $candidates = @() }
+		}
+	}
+	$candidates | Where-Object { $_ -like "$wordToComplete*" } | ForEach-Object {
+		[System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+	}
+}
+`, psList(flags), psList(names), psList(versionCommands), completeCommand, psList(completionShells), psList(envShells))
+	default:
+		return errors.Errorf("unknown shell %q, want %s", shell, strings.Join(completionShells, ", "))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// fishQuote quotes s for fish, where a backslash escapes the single quote and
+// itself inside single quotes.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// psList returns a PowerShell array literal of the single quoted items.
+func psList(items []string) string {
+	quoted := make([]string, len(items))
+	for i, s := range items {
+		quoted[i] = "'" + strings.ReplaceAll(s, "'", "''") + "'"
+	}
+	return strings.Join(quoted, ",")
+}
+
+// firstSentence returns the usage text up to its first comma or semicolon, short
+// enough for a completion menu.
+func firstSentence(s string) string {
+	// e2env prefixes the usage with the environment variable and its default
+	if _, rest, ok := strings.Cut(s, " ,"); ok && strings.Contains(s[:len(s)-len(rest)], "=") {
+		s = rest
+	}
+	if i := strings.IndexAny(s, ",;("); i > 0 {
+		s = s[:i]
+	}
+	return strings.TrimSpace(s)
+}
+
+// completeVersions prints the versions the version argument of cmd can take, one
+// per line: the releases for this platform for install, download and bundle, and
+// the installed versions and backups for use and remove. Failures print nothing,
+// the shell has no good place to show them.
+func completeVersions(ctx context.Context, src Source, cmd string) error {
+	switch cmd {
+	case "install", "download", "bundle":
+		goos, goarch := HostPlatform()
+		rs, err := Releases(ctx, ReleaseOptions{Source: src, All: allReleases, Channel: releaseChannel, OS: goos, Arch: goarch})
+		if err != nil {
+			logger.Debug("complete versions", "err", err)
+			return nil
+		}
+		for _, r := range rs {
+			fmt.Fprintln(os.Stdout, r.Version)
+		}
+	case "use", "remove":
+		seen := map[string]bool{}
+		if versionsDir != "" {
+			entries, _ := os.ReadDir(versionsDir)
+			for _, e := range entries {
+				if v, err := readVersionFile(filepath.Join(versionsDir, e.Name())); err == nil && e.Name() == v {
+					seen[v] = true
+				}
+			}
+		}
+		if goRoot, err := selectedGoRoot(ctx); cmd == "remove" && err == nil {
+			backups, _ := findBackups(goRoot, backupDir, backupRoot)
+			for _, b := range backups {
+				seen[b.Version] = true
+			}
+		}
+		var versions []string
+		for v := range seen {
+			versions = append(versions, v)
+		}
+		sort.Slice(versions, func(i, j int) bool { return CompareVersions(versions[i], versions[j]) > 0 })
+		for _, v := range versions {
+			fmt.Fprintln(os.Stdout, v)
+		}
+	}
+	return nil
+}
+
+// selectedGoRoot returns the toolchain godl currently selects: the current link
+// of -versions-dir, the -prefix or -user installation, GOROOT, or else the root
+// of the go command found on PATH.
+func selectedGoRoot(ctx context.Context) (string, error) {
+	switch {
+	case versionsDir != "":
+		link := filepath.Join(versionsDir, currentLink)
+		if _, err := os.Stat(link); err != nil {
+			return "", errors.Errorf("no version of %s is in use, pick one with godl use -versions-dir %s <version>", versionsDir, versionsDir)
+		}
+		return filepath.Abs(link)
+	case installPrefix != "":
+		return filepath.Abs(installPrefix)
+	case userInstall:
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", errors.Wrap(err, "-user")
+		}
+		return filepath.Join(home, ".local", "go"), nil
+	case os.Getenv("GOROOT") != "":
+		return filepath.Clean(os.Getenv("GOROOT")), nil
+	}
+	out, err := execabs.CommandContext(ctx, "go", "env", "GOROOT").Output()
+	if err != nil {
+		return "", errors.New("no toolchain selected: set GOROOT, give -prefix, -user or -versions-dir, or put go on PATH")
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// writeEnv writes the lines selecting the toolchain at goRoot for shell, for
+// eval "$(godl env)" and its fish and PowerShell equivalents.
+func writeEnv(w io.Writer, goRoot, shell string) error {
+	var s string
+	switch shell {
+	case "", "sh", "bash", "zsh":
+		s = shellExports(goRoot)
+	case "fish":
+		s = fmt.Sprintf("set -gx GOROOT %s\nset -gx PATH $GOROOT/bin $PATH\n", fishQuote(goRoot))
+	case "powershell":
+		sep := ":"
+		if runtime.GOOS == "windows" {
+			sep = ";"
+		}
+		s = fmt.Sprintf("$env:GOROOT = '%s'\n$env:PATH = (Join-Path $env:GOROOT 'bin') + '%s' + $env:PATH\n", strings.ReplaceAll(goRoot, "'", "''"), sep)
+	default:
+		return errors.Errorf("unknown shell %q, want %s", shell, strings.Join(envShells, ", "))
+	}
+	_, err := io.WriteString(w, s)
+	return err
+}
@@ -0,0 +1,191 @@
+package godl
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/e2u/e2util/e2env"
+)
+
+// option is a registered setting, kept so the resolved configuration can be printed.
+type option struct {
+	name string
+	// env and config report whether the environment variable and the config file
+	// are read for the setting
+	env    bool
+	config bool
+	value  func() any
+}
+
+// options lists every setting in registration order.
+var options []option
+
+// stringVar registers a string setting read from the flag or environment variable
+// name, defaulting to the config file setting name, if any, and value otherwise.
+func stringVar(p *string, name, value, usage string) {
+	value = configDefault(name, value, func(s string) (string, error) { return s, nil })
+	e2env.EnvStringVar(p, name, value, usage)
+	options = append(options, option{name: name, env: true, config: true, value: func() any { return *p }})
+}
+
+// secretStringVar is stringVar for credentials, which the printed configuration
+// only shows as set or not.
+func secretStringVar(p *string, name, usage string) {
+	e2env.EnvStringVar(p, name, configDefault(name, "", func(s string) (string, error) { return s, nil }), usage)
+	options = append(options, option{name: name, env: true, config: true, value: func() any {
+		if *p == "" {
+			return ""
+		}
+		return "<redacted>"
+	}})
+}
+
+// boolVar registers a bool setting like stringVar.
+func boolVar(p *bool, name string, value bool, usage string) {
+	e2env.EnvBoolVar(p, name, configDefault(name, value, strconv.ParseBool), usage)
+	options = append(options, option{name: name, env: true, config: true, value: func() any { return *p }})
+}
+
+// intVar registers an int setting like stringVar.
+func intVar(p *int, name string, value int, usage string) {
+	e2env.EnvIntVar(p, name, configDefault(name, value, strconv.Atoi), usage)
+	options = append(options, option{name: name, env: true, config: true, value: func() any { return *p }})
+}
+
+// listVar registers a repeatable setting: every use of the flag adds a value,
+// replacing the single value of the environment variable or the config file.
+// Like e2env, a set environment variable wins and the flag is not registered.
+func listVar(p *[]string, name, usage string) {
+	switch v, ok := fileConfig[name]; {
+	case os.Getenv(envKey(name)) != "":
+		*p = []string{os.Getenv(envKey(name))}
+	case ok:
+		*p = []string{v}
+		fallthrough
+	default:
+		flag.Var(&listValue{p: p}, name, fmt.Sprintf("%s= ,%s", envKey(name), usage))
+	}
+	options = append(options, option{name: name, env: true, config: true, value: func() any { return strings.Join(*p, "; ") }})
+}
+
+// listValue is the flag.Value of listVar.
+type listValue struct {
+	p   *[]string
+	set bool
+}
+
+func (l *listValue) String() string {
+	if l == nil || l.p == nil {
+		return ""
+	}
+	return strings.Join(*l.p, "; ")
+}
+
+func (l *listValue) Set(s string) error {
+	if !l.set {
+		*l.p, l.set = nil, true
+	}
+	*l.p = append(*l.p, s)
+	return nil
+}
+
+// noEnvStringVar is stringVar without the environment variable, for settings
+// whose bare names, such as PREFIX or USER, are set in the environment for other
+// programs.
+func noEnvStringVar(p *string, name, value, usage string) {
+	flag.StringVar(p, name, configDefault(name, value, func(s string) (string, error) { return s, nil }), usage)
+	options = append(options, option{name: name, config: true, value: func() any { return *p }})
+}
+
+// noEnvBoolVar is boolVar without the environment variable, like noEnvStringVar.
+func noEnvBoolVar(p *bool, name string, value bool, usage string) {
+	flag.BoolVar(p, name, configDefault(name, value, strconv.ParseBool), usage)
+	options = append(options, option{name: name, config: true, value: func() any { return *p }})
+}
+
+// noEnvIntVar is intVar without the environment variable, like noEnvStringVar.
+func noEnvIntVar(p *int, name string, value int, usage string) {
+	flag.IntVar(p, name, configDefault(name, value, strconv.Atoi), usage)
+	options = append(options, option{name: name, config: true, value: func() any { return *p }})
+}
+
+// flagStringVar registers a string setting that is only read from the command line.
+func flagStringVar(p *string, name, value, usage string) {
+	flag.StringVar(p, name, value, usage)
+	options = append(options, option{name: name, value: func() any { return *p }})
+}
+
+// setting is a resolved option and where its value came from.
+type setting struct {
+	Name   string `json:"name"`
+	Value  any    `json:"value"`
+	Source string `json:"source"`
+}
+
+// envKey returns the environment variable e2env reads for the setting name.
+func envKey(name string) string {
+	return strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// resolvedConfig returns the value and source of every option sorted by name. It
+// must be called after flag.Parse. e2env only registers a flag when the environment
+// variable does not provide a usable value, so an unregistered flag means the value
+// came from the environment; a flag left alone has the config file value, if any.
+func resolvedConfig() []setting {
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	out := make([]setting, 0, len(options))
+	for _, o := range options {
+		_, configured := fileConfig[o.name]
+		source := "default"
+		switch {
+		case o.env && flag.Lookup(o.name) == nil:
+			source = "env " + envKey(o.name)
+		case set[o.name]:
+			source = "flag"
+		case o.config && configured:
+			source = "config " + configPath
+		}
+		out = append(out, setting{Name: o.name, Value: o.value(), Source: source})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// explicitlySet reports whether the option name was given on the command line,
+// through its environment variable or in the config file rather than left at its
+// default.
+func explicitlySet(name string) bool {
+	if _, ok := fileConfig[name]; ok {
+		if o, ok := lookupOption(name); ok && o.config {
+			return true
+		}
+	}
+	if flag.Lookup(name) == nil {
+		return true
+	}
+	set := false
+	flag.Visit(func(f *flag.Flag) { set = set || f.Name == name })
+	return set
+}
+
+// printConfig writes the resolved configuration to w, one setting per line or as
+// JSON when asJSON is set.
+func printConfig(w io.Writer, asJSON bool) error {
+	cfg := resolvedConfig()
+	if asJSON {
+		return json.NewEncoder(w).Encode(cfg)
+	}
+	for _, s := range cfg {
+		if _, err := fmt.Fprintf(w, "%-24s %-20v %s\n", s.Name, s.Value, s.Source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package godl
+
+import (
+	"flag"
+	"testing"
+)
+
+func TestNoEnvSettings(t *testing.T) {
+	set(t, &flag.CommandLine, flag.NewFlagSet("godl", flag.ContinueOnError))
+	set(t, &options, nil)
+	set(t, &fileConfig, map[string]string{"user": "true"})
+	t.Setenv("PREFIX", "/data/data/com.termux/files/usr")
+	t.Setenv("USER", "gopher")
+	var prefix string
+	var user bool
+	noEnvStringVar(&prefix, "prefix", "", "")
+	noEnvBoolVar(&user, "user", false, "")
+	if err := flag.CommandLine.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	if prefix != "" || !user {
+		t.Errorf("prefix %q, user %v, want the defaults and the config file, not $PREFIX and $USER", prefix, user)
+	}
+	for _, s := range resolvedConfig() {
+		if want := map[string]string{"prefix": "default", "user": "config " + configPath}[s.Name]; s.Source != want {
+			t.Errorf("%s comes from %s, want %s", s.Name, s.Source, want)
+		}
+	}
+	if err := flag.CommandLine.Parse([]string{"-prefix", "/opt/go"}); err != nil || prefix != "/opt/go" {
+		t.Errorf("-prefix /opt/go set %q, %v", prefix, err)
+	}
+}
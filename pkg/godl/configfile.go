@@ -0,0 +1,256 @@
+package godl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// fileConfig holds the settings of the config file by option name, as the text
+// of their values; loadConfig fills it before the options are registered.
+var fileConfig = map[string]string{}
+
+// configPath is the config file that was read, GODL_CONFIG or the default.
+var configPath string
+
+// defaultConfigPath returns godl/config.toml in the user configuration directory,
+// ~/.config/godl/config.toml on Linux.
+func defaultConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "godl", "config.toml"), nil
+}
+
+// loadConfig reads the config file named by GODL_CONFIG, or the default one, into
+// fileConfig; a missing file sets nothing. Its settings are the defaults of the options they
+// name, so the precedence is environment variable, flag, config file, built-in
+// default.
+func loadConfig() error {
+	p := os.Getenv("GODL_CONFIG")
+	if p == "" {
+		var err error
+		if p, err = defaultConfigPath(); err != nil {
+			return nil
+		}
+	}
+	configPath = p
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "read config")
+	}
+	defer f.Close()
+	cfg, err := parseConfig(f)
+	if err != nil {
+		return errors.Wrap(err, p)
+	}
+	fileConfig = cfg
+	return nil
+}
+
+// parseConfig parses the subset of TOML a flat list of settings needs: one
+// key = value per line, where the key is an option name, with - or _ between
+// words, and the value a quoted string, a boolean or an integer. # starts a
+// comment; tables are rejected, every setting is top level.
+func parseConfig(r io.Reader) (map[string]string, error) {
+	cfg := map[string]string{}
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			return nil, errors.Errorf("line %d: tables are not supported, put every setting at the top level", n)
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, errors.Errorf("line %d: want key = value", n)
+		}
+		key = strings.Trim(strings.TrimSpace(key), `"`)
+		v, err := parseConfigValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d", n)
+		}
+		cfg[strings.ReplaceAll(key, "_", "-")] = v
+	}
+	return cfg, s.Err()
+}
+
+// parseConfigValue returns the text of a TOML string, boolean or integer value,
+// dropping a trailing comment.
+func parseConfigValue(v string) (string, error) {
+	switch {
+	case strings.HasPrefix(v, `"`):
+		end := 1
+		for ; end < len(v) && v[end] != '"'; end++ {
+			if v[end] == '\\' {
+				end++
+			}
+		}
+		if end >= len(v) {
+			return "", errors.New("unterminated string")
+		}
+		if rest := strings.TrimSpace(v[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+			return "", errors.Errorf("unexpected %q after the string", rest)
+		}
+		return strconv.Unquote(v[:end+1])
+	case strings.HasPrefix(v, "'"):
+		end := strings.Index(v[1:], "'")
+		if end < 0 {
+			return "", errors.New("unterminated string")
+		}
+		if rest := strings.TrimSpace(v[end+2:]); rest != "" && !strings.HasPrefix(rest, "#") {
+			return "", errors.Errorf("unexpected %q after the string", rest)
+		}
+		return v[1 : end+1], nil
+	}
+	if i := strings.Index(v, "#"); i >= 0 {
+		v = strings.TrimSpace(v[:i])
+	}
+	if v == "true" || v == "false" {
+		return v, nil
+	}
+	if _, err := strconv.Atoi(strings.ReplaceAll(v, "_", "")); err == nil {
+		return strings.ReplaceAll(v, "_", ""), nil
+	}
+	return "", errors.Errorf("value %q is not a quoted string, a boolean or an integer", v)
+}
+
+// configDefault returns the config file value for the option name, parsed with
+// parse, or value when the file does not set it. A value that does not parse is
+// fatal, like an invalid flag.
+func configDefault[T any](name string, value T, parse func(string) (T, error)) T {
+	s, ok := fileConfig[name]
+	if !ok {
+		return value
+	}
+	v, err := parse(s)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: invalid value %q for %s: %s\n", configPath, s, name, err)
+		os.Exit(2)
+	}
+	return v
+}
+
+// checkConfigKeys warns about config file settings that name no option a config
+// file can set.
+func checkConfigKeys() {
+	for name := range fileConfig {
+		if o, ok := lookupOption(name); !ok || !o.config {
+			warnf("%s: unknown setting %q", configPath, name)
+		}
+	}
+}
+
+// lookupOption returns the registered option name.
+func lookupOption(name string) (option, bool) {
+	for _, o := range options {
+		if o.name == name {
+			return o, true
+		}
+	}
+	return option{}, false
+}
+
+// runConfigCommand runs godl config: with no arguments it prints the resolved
+// settings like -print-config, get prints the value the config file sets, set
+// and unset change it.
+func runConfigCommand(w io.Writer, args []string) error {
+	if len(args) == 0 {
+		return printConfig(w, jsonOutput)
+	}
+	switch args[0] {
+	case "path":
+		_, err := fmt.Fprintln(w, configPath)
+		return err
+	case "get":
+		v, ok := fileConfig[normalizeKey(args[1])]
+		if !ok {
+			return errors.Errorf("%s does not set %s", configPath, args[1])
+		}
+		_, err := fmt.Fprintln(w, v)
+		return err
+	case "set":
+		name := normalizeKey(args[1])
+		o, ok := lookupOption(name)
+		if !ok || !o.config {
+			return errors.Errorf("unknown setting %q", args[1])
+		}
+		line, err := formatConfigLine(name, args[2], o.value())
+		if err != nil {
+			return err
+		}
+		return editConfig(name, line)
+	case "unset":
+		return editConfig(normalizeKey(args[1]), "")
+	}
+	return errors.Errorf("unknown config command %q, want get, set, unset or path", args[0])
+}
+
+// normalizeKey turns a TOML style key such as install_prefix into the option
+// name install-prefix.
+func normalizeKey(key string) string {
+	return strings.ReplaceAll(strings.TrimLeft(key, "-"), "_", "-")
+}
+
+// formatConfigLine returns the config file line setting name to value, checked
+// against the type of the option's current value.
+func formatConfigLine(name, value string, current any) (string, error) {
+	switch current.(type) {
+	case bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", errors.Errorf("%s takes true or false, got %q", name, value)
+		}
+		return fmt.Sprintf("%s = %t", name, b), nil
+	case int:
+		if _, err := strconv.Atoi(value); err != nil {
+			return "", errors.Errorf("%s takes an integer, got %q", name, value)
+		}
+		return fmt.Sprintf("%s = %s", name, value), nil
+	}
+	return fmt.Sprintf("%s = %s", name, strconv.Quote(value)), nil
+}
+
+// editConfig replaces the line setting name in the config file with line, or
+// appends it, and removes the setting when line is empty. Comments and the
+// other settings are kept as they are.
+func editConfig(name, line string) error {
+	b, err := os.ReadFile(configPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var out []string
+	replaced := false
+	for _, l := range strings.Split(strings.TrimRight(string(b), "\n"), "\n") {
+		key, _, ok := strings.Cut(l, "=")
+		if ok && !strings.HasPrefix(strings.TrimSpace(l), "#") && normalizeKey(strings.Trim(strings.TrimSpace(key), `"`)) == name {
+			if line != "" && !replaced {
+				out = append(out, line)
+			}
+			replaced = true
+			continue
+		}
+		if l != "" || len(out) > 0 {
+			out = append(out, l)
+		}
+	}
+	if !replaced && line != "" {
+		out = append(out, line)
+	}
+	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(configPath, strings.NewReader(strings.Join(out, "\n")+"\n"), 0600, false)
+}
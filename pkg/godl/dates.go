@@ -0,0 +1,66 @@
+package godl
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/e2u/e2util/e2http"
+)
+
+// maxDateLookups bounds the number of concurrent HEAD requests issued by releaseDates.
+const maxDateLookups = 4
+
+// releaseDates returns the Last-Modified time of each file's archive keyed by file
+// name. The go.dev JSON carries no dates, so the upload time of the archive is the
+// best approximation of the release date. Files whose date cannot be determined are
+// left out of the result.
+func releaseDates(ctx context.Context, src Source, files []File) map[string]time.Time {
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		sem   = make(chan struct{}, maxDateLookups)
+		dates = make(map[string]time.Time, len(files))
+	)
+	for _, file := range files {
+		wg.Add(1)
+		go func(file File) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			c := e2http.Builder(ctx).URL(src.fileURL(file.Filename)).Method(http.MethodHead).Do()
+			if len(c.Errors()) > 0 || c.StatusCode() != http.StatusOK {
+				return
+			}
+			t, err := http.ParseTime(c.Headers().Get("Last-Modified"))
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			dates[file.Filename] = t
+			mu.Unlock()
+		}(file)
+	}
+	wg.Wait()
+	return dates
+}
+
+// formatAge describes how long ago a release published at t was relative to now.
+func formatAge(t, now time.Time) string {
+	return "released " + daysAgo(t, now)
+}
+
+// daysAgo describes the age of t in whole days relative to now.
+func daysAgo(t, now time.Time) string {
+	switch days := int(now.Sub(t).Hours() / 24); days {
+	case 0:
+		return "today"
+	case 1:
+		return "1 day ago"
+	default:
+		return fmt.Sprintf("%d days ago", days)
+	}
+}
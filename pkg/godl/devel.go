@@ -0,0 +1,101 @@
+package godl
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// defaultDevelRoot returns where -devel installs snapshots unless -devel-root says
+// otherwise, the same place the gotip command uses.
+func defaultDevelRoot() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, "sdk", "gotip"), nil
+}
+
+// installDevel installs the newest development snapshot of src into root, replacing
+// the snapshot installed there before. GOROOT is never touched.
+func installDevel(ctx context.Context, src Source, iv InstalledVersion, root string) error {
+	if src.DevelURL == "" {
+		return errors.New("-devel needs a source publishing development snapshots, set -devel-url")
+	}
+	rs, err := fetchReleaseList(ctx, src.DevelURL)
+	if err != nil {
+		return err
+	}
+	if len(rs) == 0 {
+		return errors.Errorf("%s lists no development snapshots", src.DevelURL)
+	}
+	snapshot := rs[0]
+	var file File
+	for _, f := range snapshot.Files {
+		if f.Kind == "archive" && f.Os == iv.Os && f.Arch == iv.Arch {
+			file = f
+			break
+		}
+	}
+	if file.Filename == "" {
+		return errors.Errorf("snapshot %s has no archive for %s/%s", snapshot.Version, iv.Os, iv.Arch)
+	}
+	warnf("%s is a development snapshot, not a stable release", snapshot.Version)
+	if v, err := readVersionFile(root); err == nil && v == snapshot.Version {
+		fmt.Fprintf(stdout, "%s is already installed in %s\n", v, root)
+		return nil
+	}
+	emit(streamEvent{Event: "resolve", Version: snapshot.Version, File: file.Filename})
+	if dryRun {
+		fmt.Fprintf(stdout, "would install %s into %s\n", file.Filename, root)
+		return nil
+	}
+
+	archivePath, temp, err := fetchArchive(ctx, src, file)
+	if temp {
+		defer removeDownload(archivePath)
+	}
+	if err != nil {
+		return err
+	}
+	if err := verifyArchive(file, archivePath); err != nil {
+		return err
+	}
+	r, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	parent := filepath.Dir(root)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return err
+	}
+	extractDir, err := os.MkdirTemp(parent, "."+filepath.Base(root)+".staging-")
+	if err != nil {
+		return err
+	}
+	defer removeStaging(extractDir)
+	pr := newProgressReader(r)
+	if err := extractRelease(pr, file.Filename, extractDir); err != nil {
+		return errors.Wrap(err, "extract archive error")
+	}
+	pr.finish()
+
+	// the previous snapshot is only removed once the new one is in place
+	old := filepath.Join(extractDir, "old")
+	if err := os.Rename(root, old); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Rename(filepath.Join(extractDir, archiveRoot), root); err != nil {
+		os.Rename(old, root)
+		return err
+	}
+	emit(streamEvent{Event: "install", Version: snapshot.Version, GoRoot: root})
+	fmt.Fprintf(stdout, "installed %s into %s\n", snapshot.Version, root)
+	fmt.Fprint(stdout, shellExports(root))
+	return nil
+}
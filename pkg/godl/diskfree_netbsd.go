@@ -0,0 +1,26 @@
+package godl
+
+import "golang.org/x/sys/unix"
+
+// freeSpace returns the bytes available to unprivileged users on the filesystem
+// holding path.
+func freeSpace(path string) (uint64, error) {
+	var st unix.Statvfs_t
+	if err := unix.Statvfs(path, &st); err != nil {
+		return 0, err
+	}
+	return st.Bavail * st.Frsize, nil
+}
+
+// freeInodes returns the inodes available to unprivileged users on the filesystem
+// holding path. limited is false for filesystems without a fixed inode table.
+func freeInodes(path string) (free uint64, limited bool, err error) {
+	var st unix.Statvfs_t
+	if err := unix.Statvfs(path, &st); err != nil {
+		return 0, false, err
+	}
+	if st.Files == 0 {
+		return 0, false, nil
+	}
+	return st.Favail, true, nil
+}
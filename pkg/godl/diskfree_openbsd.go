@@ -0,0 +1,29 @@
+package godl
+
+import "golang.org/x/sys/unix"
+
+// freeSpace returns the bytes available to unprivileged users on the filesystem
+// holding path.
+func freeSpace(path string) (uint64, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	if st.F_bavail < 0 {
+		return 0, nil
+	}
+	return uint64(st.F_bavail) * uint64(st.F_bsize), nil
+}
+
+// freeInodes returns the inodes available to unprivileged users on the filesystem
+// holding path. limited is false for filesystems without a fixed inode table.
+func freeInodes(path string) (free uint64, limited bool, err error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return 0, false, err
+	}
+	if st.F_files == 0 {
+		return 0, false, nil
+	}
+	return uint64(max(st.F_favail, 0)), true, nil
+}
@@ -0,0 +1,15 @@
+//go:build !linux && !darwin && !freebsd && !dragonfly && !netbsd && !openbsd && !windows
+
+package godl
+
+import "github.com/pkg/errors"
+
+// freeSpace is not implemented on this platform.
+func freeSpace(path string) (uint64, error) {
+	return 0, errors.New("free space is not available on this platform")
+}
+
+// freeInodes is not implemented on this platform.
+func freeInodes(path string) (free uint64, limited bool, err error) {
+	return 0, false, errors.New("free inodes are not available on this platform")
+}
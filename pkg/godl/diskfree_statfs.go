@@ -0,0 +1,29 @@
+//go:build linux || darwin || freebsd || dragonfly
+
+package godl
+
+import "golang.org/x/sys/unix"
+
+// freeSpace returns the bytes available to unprivileged users on the filesystem
+// holding path.
+func freeSpace(path string) (uint64, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
+
+// freeInodes returns the inodes available on the filesystem holding path. limited
+// is false for filesystems without a fixed inode table, which report none.
+func freeInodes(path string) (free uint64, limited bool, err error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return 0, false, err
+	}
+	files, ffree := int64(st.Files), int64(st.Ffree)
+	if files <= 0 {
+		return 0, false, nil
+	}
+	return uint64(max(ffree, 0)), true, nil
+}
@@ -0,0 +1,22 @@
+package godl
+
+import "golang.org/x/sys/windows"
+
+// freeSpace returns the bytes available to the current user on the volume holding
+// path.
+func freeSpace(path string) (uint64, error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var avail uint64
+	if err := windows.GetDiskFreeSpaceEx(p, &avail, nil, nil); err != nil {
+		return 0, err
+	}
+	return avail, nil
+}
+
+// freeInodes reports no limit, NTFS has no fixed number of file records.
+func freeInodes(path string) (free uint64, limited bool, err error) {
+	return 0, false, nil
+}
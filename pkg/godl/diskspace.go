@@ -0,0 +1,93 @@
+package godl
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// reportDiskUsage prints the space an install of the tree at stagingDir would take:
+// the size of the current GOROOT, which stays around as the backup, the size of
+// the new tree and the free space on the filesystem of target, where the new tree
+// ends up. goRoot is empty when installing into a versions directory.
+func reportDiskUsage(w io.Writer, goRoot, stagingDir, target string) error {
+	newSize, err := dirSize(stagingDir)
+	if err != nil {
+		return err
+	}
+	free, ferr := freeSpace(target)
+	freeText := "unknown free space"
+	if ferr == nil {
+		freeText = formatBytes(int64(free)) + " free"
+	}
+	if goRoot == "" {
+		fmt.Fprintf(w, "disk: new %s, %s on %s\n", formatBytes(newSize), freeText, target)
+	} else {
+		oldSize, err := dirSize(goRoot)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "disk: GOROOT %s, new %s, backup keeps %s, %s on %s\n",
+			formatBytes(oldSize), formatBytes(newSize), formatBytes(oldSize), freeText, target)
+	}
+	// a staging tree on the target filesystem already occupies its space
+	if ferr == nil && !sameFilesystem(filepath.Dir(stagingDir), target) && uint64(newSize) > free {
+		warnf("the new tree needs %s but only %s are free on %s", formatBytes(newSize), formatBytes(int64(free)), target)
+	}
+	return nil
+}
+
+// extractedRatio estimates how much larger the extracted tree of a release archive
+// is than the archive; a Go release of about 70 MiB extracts to about 250 MiB.
+const extractedRatio = 4
+
+// checkSpace fails before anything is downloaded when downloadDir has no room for
+// the archive of size bytes, or installDir, where the extracted tree ends up, has
+// none for the tree. An empty installDir only checks the download. When both are
+// on one filesystem it has to hold both at once.
+func checkSpace(size int64, downloadDir, installDir string) error {
+	type need struct {
+		dir   string
+		bytes uint64
+	}
+	needs := []need{{downloadDir, uint64(size)}}
+	if installDir != "" {
+		if sameFilesystem(downloadDir, installDir) {
+			needs[0].bytes += uint64(size) * extractedRatio
+		} else {
+			needs = append(needs, need{installDir, uint64(size) * extractedRatio})
+		}
+	}
+	for _, n := range needs {
+		free, err := freeSpace(n.dir)
+		if err != nil {
+			// without a usable statfs the check is skipped
+			continue
+		}
+		if n.bytes > free {
+			return errors.Errorf("about %s are needed on %s but only %s are free, use -check-space=false to try anyway",
+				formatBytes(int64(n.bytes)), n.dir, formatBytes(int64(free)))
+		}
+	}
+	return nil
+}
+
+// checkInodes fails when the filesystem holding dir has fewer free inodes than the
+// archive at path, the release file filename, has entries, which would make the
+// extraction fail half way even with enough free bytes.
+func checkInodes(path, filename, dir string) error {
+	free, limited, err := freeInodes(dir)
+	if err != nil || !limited {
+		return nil
+	}
+	n, err := countArchiveEntries(path, filename, onlyPaths())
+	if err != nil {
+		return errors.Wrap(err, "count archive entries")
+	}
+	if uint64(n) > free {
+		return errors.Errorf("the archive has %d entries but only %d inodes are free on %s, use -check-inodes=false to try anyway", n, free, dir)
+	}
+	return nil
+}
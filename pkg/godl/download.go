@@ -0,0 +1,231 @@
+package godl
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/execabs"
+)
+
+// archiveOptions are the settings fetchArchiveWith downloads with.
+type archiveOptions struct {
+	// out receives the human readable progress
+	out io.Writer
+	// cacheDir is an archive cache like -cache-archives, offline uses only it
+	cacheDir string
+	offline  bool
+	// connections is the number of concurrent Range requests, like -connections
+	connections int
+	// progress receives the download progress, nil renders the progress bar
+	progress ProgressFunc
+}
+
+// fetchArchive returns the path of the archive of file, taken from the -cache-archives
+// directory when it holds a copy or downloaded otherwise. temp reports whether the
+// path is a temporary download the caller has to remove, also when err is set.
+func fetchArchive(ctx context.Context, src Source, file File) (path string, temp bool, err error) {
+	return fetchArchiveWith(ctx, src, file, archiveOptions{out: stdout, cacheDir: cacheDir, offline: offline, connections: connections})
+}
+
+// fetchArchiveWith is fetchArchive with opts instead of the flags.
+func fetchArchiveWith(ctx context.Context, src Source, file File, opts archiveOptions) (path string, temp bool, err error) {
+	settings := settingsOf(ctx)
+	if opts.cacheDir != "" {
+		if p, ok := cachedArchive(opts.cacheDir, file); ok {
+			fmt.Fprintln(opts.out, "using cached: ", p)
+			return p, false, nil
+		}
+	}
+	if opts.offline {
+		return "", false, errors.Errorf("-offline is set and %s is not in -cache-archives", file.Filename)
+	}
+	f, err := os.CreateTemp(os.TempDir(), filepath.Base(file.Filename))
+	if err != nil {
+		return "", false, err
+	}
+	var n int64
+	var u string
+	var start time.Time
+	urls := src.fileURLs(file.Filename)
+	for i := range urls {
+		u = urls[i]
+		fmt.Fprintln(opts.out, "downloading: ", u)
+		start = time.Now()
+		if opts.connections > 1 && file.Size >= 2*minChunkSize {
+			if n, err = downloadChunked(ctx, u, f, int64(file.Size), opts.connections); err == nil || ctx.Err() != nil {
+				break
+			}
+			settings.warnf("download %s in %d chunks: %s, downloading in one stream", u, opts.connections, err)
+		}
+		if n, err = downloadFile(ctx, u, f, int64(file.Size), opts.progress); err == nil || ctx.Err() != nil {
+			break
+		}
+		if i+1 < len(urls) {
+			settings.warnf("download %s: %s, trying the next mirror", u, err)
+		}
+	}
+	f.Close()
+	if err != nil {
+		return f.Name(), true, errors.Wrap(err, "download install package error")
+	}
+	if !settings.client {
+		atomic.AddInt64(&metrics.DownloadBytes, n)
+	}
+	settings.logger().Info("downloaded", "url", u, "version", fileVersion(file), "bytes", n, "duration", time.Since(start))
+
+	if opts.cacheDir != "" {
+		if err := storeArchive(opts.cacheDir, file, f.Name()); err != nil {
+			settings.warnf("cache archive error: %s", err)
+		}
+	}
+	return f.Name(), true, nil
+}
+
+// removeDownload removes the temporary download at path, or with -keep-download
+// leaves it for inspection and prints where it is.
+func removeDownload(path string) {
+	if keepDownload {
+		fmt.Fprintln(os.Stderr, "kept download: ", path)
+		return
+	}
+	os.Remove(path)
+}
+
+// removeStaging removes the staging directory dir, or with -keep-staging leaves
+// it for inspection and prints where it is. Once the staged tree was moved into
+// place dir is gone or empty and is removed either way.
+func removeStaging(dir string) {
+	if keepStagingDir {
+		if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+			fmt.Fprintln(os.Stderr, "kept staging: ", dir)
+			return
+		}
+	}
+	os.RemoveAll(dir)
+}
+
+// DownloadOptions controls Download.
+type DownloadOptions struct {
+	// Source resolves the download URL, defaultSource when zero.
+	Source Source
+	// Progress is called as the download advances, see ProgressFunc. When nil the
+	// command line progress bar is rendered on a terminal.
+	Progress ProgressFunc
+}
+
+// Download fetches file into w without verifying it and returns the number of
+// bytes written. The download fails when it is shorter or longer than file.Size.
+func Download(ctx context.Context, file File, w io.Writer, opts DownloadOptions) (int64, error) {
+	src := opts.Source
+	if src.isZero() {
+		src = defaultSource
+	}
+	return download(ctx, src.fileURL(file.Filename), w, int64(file.Size), opts.Progress)
+}
+
+// copyFile copies src to dst through a temporary file in the destination directory,
+// so dst either has the complete content or is left untouched.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.CreateTemp(filepath.Dir(dst), ".tmp-"+filepath.Base(dst))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(out.Name(), dst)
+}
+
+// verifyChecksum returns an error unless the SHA256 digest of the file at path is want.
+func verifyChecksum(path string, want string) error {
+	sum, err := hashFile(path)
+	if err != nil {
+		return err
+	}
+	ok := strings.EqualFold(sum, want)
+	emit(streamEvent{Event: "verify", File: filepath.Base(path), OK: &ok})
+	if !ok {
+		return withKind(ErrChecksumMismatch, errors.Errorf("sha256 mismatch: got %s, want %s", sum, want))
+	}
+	return nil
+}
+
+// extractSource verifies the source archive at path and extracts it into
+// <dir>/<version>, returning the directory holding the go source tree.
+func extractSource(file File, path, dir string) (string, error) {
+	return extractVerified(file, path, filepath.Join(dir, fileVersion(file)))
+}
+
+// extractVerified verifies the archive at path and extracts it into dst, which is
+// created if needed, returning the go directory it contains.
+func extractVerified(file File, path, dst string) (string, error) {
+	if err := verifyArchive(file, path); err != nil {
+		return "", err
+	}
+	if _, err := os.Lstat(filepath.Join(dst, archiveRoot)); err == nil {
+		return "", errors.Errorf("%s already exists", filepath.Join(dst, archiveRoot))
+	}
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return "", err
+	}
+	r, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	pr := newProgressReader(r)
+	if err := extractRelease(pr, file.Filename, dst); err != nil {
+		return "", errors.Wrap(err, "extract archive error")
+	}
+	pr.finish()
+	return filepath.Join(dst, archiveRoot), nil
+}
+
+// saveDownload runs the verifiers on the archive at path and copies
+// it to dir under its release file name, returning the resulting path.
+func saveDownload(file File, path, dir string) (string, error) {
+	if err := verifyArchive(file, path); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	dst := filepath.Join(dir, filepath.Base(file.Filename))
+	if err := copyFile(path, dst); err != nil {
+		return "", err
+	}
+	return dst, nil
+}
+
+// runMsiexec installs a Windows installer package with msiexec.
+func runMsiexec(ctx context.Context, path string) error {
+	if runtime.GOOS != "windows" || !strings.HasSuffix(path, ".msi") {
+		return errors.Errorf("msiexec can only install .msi packages on windows, got %s", path)
+	}
+	c := execabs.CommandContext(ctx, "msiexec", "/i", path)
+	c.Stdout = stdout
+	c.Stderr = os.Stderr
+	if err := c.Run(); err != nil {
+		return errors.Wrap(err, "msiexec")
+	}
+	fmt.Fprintf(stdout, "installed: %s\n", path)
+	return nil
+}
@@ -0,0 +1,73 @@
+package godl
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// helloSHA256 is the sha256 of "hello\n".
+const helloSHA256 = "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"
+
+// writeHello writes "hello\n" to a new file and returns its path.
+func writeHello(t *testing.T) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "go1.22.1.linux-amd64.tar.gz")
+	if err := os.WriteFile(p, []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// captureWarnings sends the warnings of the rest of the test to the returned
+// buffer, as JSON log records.
+func captureWarnings(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	set(t, &logFormat, "json")
+	set(t, &logger, slog.New(slog.NewJSONHandler(buf, nil)))
+	return buf
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	p := writeHello(t)
+	if err := verifyChecksum(p, helloSHA256); err != nil {
+		t.Errorf("matching digest: %v", err)
+	}
+	if err := verifyChecksum(p, strings.ToUpper(helloSHA256)); err != nil {
+		t.Errorf("upper case digest: %v", err)
+	}
+	err := verifyChecksum(p, strings.Repeat("0", 64))
+	if !errors.Is(err, ErrChecksumMismatch) || !strings.Contains(err.Error(), helloSHA256) {
+		t.Errorf("mismatching digest: %v, want ErrChecksumMismatch naming the actual digest", err)
+	}
+	if err := verifyChecksum(filepath.Join(t.TempDir(), "missing"), helloSHA256); err == nil {
+		t.Error("a missing file verified")
+	}
+}
+
+func TestSHA256VerifierWithoutDigest(t *testing.T) {
+	warnings := captureWarnings(t)
+	p := writeHello(t)
+	f := File{Filename: filepath.Base(p)}
+	if err := (sha256Verifier{}).Verify(f, p); err != nil {
+		t.Errorf("no published digest: %v, want a warning only", err)
+	}
+	if !strings.Contains(warnings.String(), "no sha256 for "+f.Filename) {
+		t.Errorf("no warning about the missing digest, logged %s", warnings)
+	}
+
+	set(t, &requireVerified, true)
+	if err := (sha256Verifier{}).Verify(f, p); err == nil {
+		t.Error("-require-verification accepted a file without a digest")
+	}
+	f.Sha256 = helloSHA256
+	if err := (sha256Verifier{}).Verify(f, p); err != nil {
+		t.Errorf("published digest: %v", err)
+	}
+}
@@ -0,0 +1,126 @@
+package godl
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	envrcBegin = "# >>> godl >>>"
+	envrcEnd   = "# <<< godl <<<"
+)
+
+// installVersioned moves the extracted tree at stagingDir to <versionsDir>/<version>
+// and returns the new root. Existing versions are never replaced.
+func installVersioned(stagingDir, versionsDir, version string) (string, error) {
+	root := filepath.Join(versionsDir, version)
+	if _, err := os.Lstat(root); err == nil {
+		return "", errors.Errorf("%s is already installed at %s", version, root)
+	}
+	if err := os.Rename(stagingDir, root); err != nil {
+		return "", err
+	}
+	if fsync {
+		if err := syncDir(versionsDir); err != nil {
+			return "", err
+		}
+	}
+	return root, nil
+}
+
+// currentLink is the symlink in the versions directory that use points at the
+// selected version, so that GOROOT=<versionsDir>/current switches with it.
+const currentLink = "current"
+
+// useVersion points the current symlink of versionsDir at the installed version.
+// The link is replaced atomically, so a shell with GOROOT set to it never sees it
+// missing.
+func useVersion(versionsDir, version string) error {
+	if versionsDir == "" {
+		return errors.New("use needs -versions-dir")
+	}
+	if runtime.GOOS == "windows" {
+		return errors.New("use is not supported on windows")
+	}
+	root := filepath.Join(versionsDir, version)
+	if v, err := readVersionFile(root); err != nil || v != version {
+		return errors.Errorf("%s is not installed in %s, install it with godl install -versions-dir %s %s", version, versionsDir, versionsDir, version)
+	}
+	// relative, so the versions directory can be moved as a whole
+	link := filepath.Join(versionsDir, currentLink)
+	if err := replaceSymlink(link, version); err != nil {
+		return err
+	}
+	fmt.Fprint(stdout, shellExports(link))
+	return nil
+}
+
+// printExports prints the shell lines selecting the toolchain at goRoot and, with
+// -envrc, writes them to that file as well.
+func printExports(goRoot string) error {
+	snippet := shellExports(goRoot)
+	fmt.Fprint(stdout, snippet)
+	if envrcFile != "" {
+		if err := writeEnvrc(envrcFile, snippet); err != nil {
+			return errors.Wrap(err, "write envrc error")
+		}
+	}
+	return nil
+}
+
+// installFresh moves the staged toolchain to goRoot, which does not exist yet, and
+// removes it again when verify rejects it.
+func installFresh(ctx context.Context, stagingDir, goRoot string, verify func(goRoot string) error) error {
+	if err := moveTree(stagingDir, goRoot); err != nil {
+		return errors.Wrapf(err, "move %s to %s", stagingDir, goRoot)
+	}
+	if err := verify(goRoot); err != nil {
+		if rerr := os.RemoveAll(goRoot); rerr != nil {
+			settingsOf(ctx).warnf("remove %s error: %s", goRoot, rerr)
+		}
+		return errors.Wrap(err, "verify the installed toolchain")
+	}
+	return nil
+}
+
+// shellExports returns the shell lines selecting the toolchain at goRoot.
+func shellExports(goRoot string) string {
+	return fmt.Sprintf("export GOROOT=%s\nexport PATH=\"$GOROOT/bin:$PATH\"\n", shellQuote(goRoot))
+}
+
+// shellQuote quotes s for POSIX shells. Single quotes keep spaces, $ and backquotes
+// in paths literal, which double quotes would not.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// writeEnvrc puts snippet between the godl markers of the file at path, replacing
+// the block written by an earlier run and keeping everything else in the file.
+func writeEnvrc(path, snippet string) error {
+	b, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	content := string(b)
+	block := envrcBegin + "\n" + snippet + envrcEnd + "\n"
+	if i := strings.Index(content, envrcBegin); i >= 0 {
+		if j := strings.Index(content[i:], envrcEnd); j >= 0 {
+			end := i + j + len(envrcEnd)
+			if end < len(content) && content[end] == '\n' {
+				end++
+			}
+			content = content[:i] + block + content[end:]
+			return os.WriteFile(path, []byte(content), 0644)
+		}
+	}
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	return os.WriteFile(path, []byte(content+block), 0644)
+}
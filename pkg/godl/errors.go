@@ -0,0 +1,61 @@
+package godl
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Errors callers can branch on with errors.Is. They are returned wrapped with the
+// details, so the message of the returned error stays descriptive.
+var (
+	// ErrNoNewVersion means nothing newer than the installed version is available.
+	ErrNoNewVersion = errors.New("no new version file found")
+	// ErrChecksumMismatch means a downloaded file does not match its published digest.
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	// ErrNoMatchingPlatform means no release file exists for the requested platform.
+	ErrNoMatchingPlatform = errors.New("no release file for the platform")
+	// ErrArchiveInvalid means an archive could not be read or holds unsafe entries.
+	ErrArchiveInvalid = errors.New("invalid archive")
+	// ErrUpdateAvailable is how check reports that a newer release exists.
+	ErrUpdateAvailable = errors.New("update available")
+)
+
+// kindError marks err as one of the sentinel errors above without changing its
+// message.
+type kindError struct {
+	kind, err error
+}
+
+func (e *kindError) Error() string   { return e.err.Error() }
+func (e *kindError) Unwrap() []error { return []error{e.kind, e.err} }
+
+// withKind marks err as kind for errors.Is; a nil err stays nil.
+func withKind(kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &kindError{kind: kind, err: err}
+}
+
+// runFailed reports whether a run ending with err failed. check finding an update
+// is a successful run, even though it exits nonzero.
+func runFailed(err error) bool {
+	return err != nil && !errors.Is(err, ErrUpdateAvailable)
+}
+
+// exitCode returns the exit status for a run that failed with err: 3 for a
+// checksum mismatch, 4 when the platform has no release file, 5 for an invalid
+// archive, -update-exit-code when check found an update and 1 for everything
+// else. Usage errors of the flag package exit with 2.
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, ErrUpdateAvailable):
+		return updateExitCode
+	case errors.Is(err, ErrChecksumMismatch):
+		return 3
+	case errors.Is(err, ErrNoMatchingPlatform):
+		return 4
+	case errors.Is(err, ErrArchiveInvalid):
+		return 5
+	}
+	return 1
+}
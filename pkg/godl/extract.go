@@ -0,0 +1,728 @@
+package godl
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ArchiveEntry describes an archive member passed to ExtractOptions.OnEntry.
+type ArchiveEntry struct {
+	Name    string
+	Size    int64
+	Mode    os.FileMode
+	ModTime time.Time
+	Dir     bool
+}
+
+// ExtractOptions controls ExtractArchive.
+type ExtractOptions struct {
+	// Strict fails on entries that cannot be extracted, such as devices and links
+	// leading outside destDir,
+	// and on entries whose names differ only by case, instead of logging and
+	// skipping or warning about them.
+	Strict bool
+	// AllowEscape extracts entries whose names lead outside destDir. It must never
+	// be set for archives that are not fully trusted.
+	AllowEscape bool
+	// PreserveMode keeps the permission bits of the archive, otherwise files are
+	// created 0644 and directories 0755.
+	PreserveMode bool
+	// ModeMask clears these permission bits from every extracted entry, e.g. 022
+	// to drop group and other write access whatever the archive says.
+	ModeMask os.FileMode
+	// PreserveModTime sets the modification time of files to the one in the archive.
+	PreserveModTime bool
+	// Only keeps just the entries at or below one of these slash separated paths,
+	// or matching one of them as a path.Match pattern, e.g. go/bin. Empty keeps all.
+	Only []string
+	// Prefix keeps just the entries below this top-level directory, e.g. go, and
+	// skips the other top-level entries some repackaged archives carry next to it.
+	// An archive without any entry below Prefix is invalid. Empty keeps all.
+	Prefix string
+	// MaxSize aborts the extraction once the regular files extracted add up to more
+	// than this many bytes. 0 means no limit.
+	MaxSize int64
+	// Fsync flushes every file and directory to disk before returning.
+	Fsync bool
+	// OnEntry is called before each entry is extracted; an error aborts the
+	// extraction and is returned.
+	OnEntry func(ArchiveEntry) error
+	// Logger receives the warnings about skipped entries; nil prints them like the
+	// command does.
+	Logger *slog.Logger
+}
+
+// ExtractArchive extracts the archive read from r into destDir. The format is taken
+// from filename: .tar.gz and .tgz are gzip compressed tarballs, .tar is a plain one
+// and .zip, the format of the Windows releases, a zip archive.
+func ExtractArchive(r io.Reader, filename, destDir string, opts ExtractOptions) error {
+	switch name := strings.ToLower(filename); {
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		gzr, err := gzip.NewReader(r)
+		if err != nil {
+			return withKind(ErrArchiveInvalid, gzipError(err))
+		}
+		gr := &gzipReader{r: gzr}
+		if err := extractTar(gr, destDir, opts); err != nil {
+			if gr.err != nil {
+				// whatever the tar reader made of it, the compressed stream is broken
+				return withKind(ErrArchiveInvalid, gzipError(gr.err))
+			}
+			return err
+		}
+		// the tar reader stops at the end of archive marker, reading on to the end
+		// checks the size and checksum in the gzip trailer
+		if _, err := io.Copy(io.Discard, gr); err != nil {
+			return withKind(ErrArchiveInvalid, gzipError(err))
+		}
+		return nil
+	case strings.HasSuffix(name, ".tar"):
+		return extractTar(r, destDir, opts)
+	case strings.HasSuffix(name, ".zip"):
+		return extractZipStream(r, destDir, opts)
+	}
+	return withKind(ErrArchiveInvalid, errors.Errorf("unsupported archive format of %s", filename))
+}
+
+// gzipReader remembers the first error of the gzip stream it reads, so that it can
+// be told apart from the errors of the tar stream inside it.
+type gzipReader struct {
+	r   io.Reader
+	err error
+}
+
+func (g *gzipReader) Read(p []byte) (int, error) {
+	n, err := g.r.Read(p)
+	if err != nil && err != io.EOF && g.err == nil {
+		g.err = err
+	}
+	return n, err
+}
+
+// gzipError describes a broken gzip stream. A checksum mismatch or an early end
+// almost always means the download was cut short or damaged in transit.
+func gzipError(err error) error {
+	if errors.Is(err, gzip.ErrChecksum) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return errors.Wrap(err, "corrupt gzip stream, the download is probably truncated or damaged: remove it and download again")
+	}
+	return errors.Wrap(err, "invalid gzip stream")
+}
+
+// archiveRoot is the top-level directory of the release archives, the only one
+// extractRelease extracts; the extracted toolchain is at baseDir/archiveRoot.
+const archiveRoot = "go"
+
+// extractRelease extracts the release archive filename read from r into baseDir
+// with the options of the command line.
+func extractRelease(r io.Reader, filename, baseDir string) error {
+	start := time.Now()
+	err := ExtractArchive(r, filename, baseDir, ExtractOptions{Strict: strictExtract, Prefix: archiveRoot, PreserveMode: true, ModeMask: modeMask, Only: onlyPaths(), MaxSize: int64(maxExtractMiB) << 20, Fsync: fsync})
+	if err == nil {
+		logger.Info("extracted", "file", filename, "dir", baseDir, "duration", time.Since(start))
+	}
+	return err
+}
+
+// countArchiveEntries returns the number of members of the archive at path, in the
+// format named by filename like for ExtractArchive, that an extraction with only
+// would create, without writing anything. Tarballs are read through, zip archives
+// only need their central directory.
+func countArchiveEntries(path, filename string, only []string) (int, error) {
+	name := strings.ToLower(filename)
+	if strings.HasSuffix(name, ".zip") {
+		zr, err := zip.OpenReader(path)
+		if err != nil {
+			return 0, err
+		}
+		defer zr.Close()
+		n := 0
+		for _, f := range zr.File {
+			header, err := tar.FileInfoHeader(f.FileInfo(), "")
+			if err != nil {
+				return n, errors.Wrap(err, f.Name)
+			}
+			if extractedType(header.Typeflag) && keepEntry(f.Name, only) {
+				n++
+			}
+		}
+		return n, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if !strings.HasSuffix(name, ".tar") {
+		gzr, err := gzip.NewReader(f)
+		if err != nil {
+			return 0, err
+		}
+		r = gzr
+	}
+	tr := tar.NewReader(r)
+	n := 0
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		if extractedType(header.Typeflag) && keepEntry(header.Name, only) {
+			n++
+		}
+	}
+}
+
+// extractedType reports whether entries of type t are extracted: directories,
+// regular files and links are, the others are skipped.
+func extractedType(t byte) bool {
+	switch t {
+	case tar.TypeDir, tar.TypeReg, tar.TypeSymlink, tar.TypeLink:
+		return true
+	}
+	return false
+}
+
+// onlyPaths returns the paths of the -only flag.
+func onlyPaths() []string {
+	var paths []string
+	for _, p := range strings.Split(only, ",") {
+		if p = strings.Trim(strings.TrimSpace(p), "/"); p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// keepEntry reports whether the archive member name is selected by only.
+func keepEntry(name string, only []string) bool {
+	if len(only) == 0 {
+		return true
+	}
+	name = strings.Trim(path.Clean("/"+name), "/")
+	for _, p := range only {
+		if name == p || strings.HasPrefix(name, p+"/") {
+			return true
+		}
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func extractTar(r io.Reader, destDir string, opts ExtractOptions) error {
+	tr := tar.NewReader(r)
+	x := newExtractor(destDir, opts)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return withKind(ErrArchiveInvalid, errors.Wrap(err, "malformed tar archive"))
+		}
+		if err := x.entry(header, func() (io.ReadCloser, error) { return io.NopCloser(&entryReader{tr, "malformed tar archive"}), nil }); err != nil {
+			return err
+		}
+	}
+	return x.finish()
+}
+
+// extractZip extracts the zip archive r of size bytes into destDir, applying opts
+// like extractTar does.
+func extractZip(r io.ReaderAt, size int64, destDir string, opts ExtractOptions) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return withKind(ErrArchiveInvalid, errors.Wrap(err, "malformed zip archive"))
+	}
+	x := newExtractor(destDir, opts)
+	for _, f := range zr.File {
+		header, err := tar.FileInfoHeader(f.FileInfo(), "")
+		if err != nil {
+			return withKind(ErrArchiveInvalid, errors.Wrap(err, f.Name))
+		}
+		// FileInfoHeader only keeps the base name
+		header.Name = f.Name
+		if header.Typeflag == tar.TypeSymlink {
+			// zip stores the link target as the content of the entry
+			if header.Linkname, err = readZipLink(f); err != nil {
+				return withKind(ErrArchiveInvalid, errors.Wrap(err, f.Name))
+			}
+		}
+		open := func() (io.ReadCloser, error) {
+			r, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			return struct {
+				io.Reader
+				io.Closer
+			}{&entryReader{r, "malformed zip archive"}, r}, nil
+		}
+		if err := x.entry(header, open); err != nil {
+			return err
+		}
+	}
+	return x.finish()
+}
+
+// entryReader reads the content of an archive entry and marks its errors as the
+// archive's, so that a file cut short by a truncated archive is not mistaken for
+// a failure to write it.
+type entryReader struct {
+	r    io.Reader
+	what string
+}
+
+func (e *entryReader) Read(p []byte) (int, error) {
+	n, err := e.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = withKind(ErrArchiveInvalid, errors.Wrap(err, e.what))
+	}
+	return n, err
+}
+
+// readZipLink returns the target of the symlink entry f.
+func readZipLink(f *zip.File) (string, error) {
+	r, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	b, err := io.ReadAll(io.LimitReader(r, 4096))
+	return string(b), err
+}
+
+// extractZipStream extracts the zip archive read from r. zip needs random access,
+// so r is spooled to a temporary file first unless it is one already.
+func extractZipStream(r io.Reader, destDir string, opts ExtractOptions) error {
+	f, ok := r.(*os.File)
+	if !ok {
+		tmp, err := os.CreateTemp(os.TempDir(), "godl-*.zip")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+		if _, err := io.Copy(tmp, r); err != nil {
+			return err
+		}
+		f = tmp
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return extractZip(f, info.Size(), destDir, opts)
+}
+
+// extractor writes the entries of one archive, whatever its format, below destDir.
+type extractor struct {
+	destDir string
+	opts    ExtractOptions
+	// names by their case folded form; on case-insensitive filesystems such as the
+	// macOS and Windows defaults entries differing only by case overwrite each other
+	folded map[string]string
+	// the top-level entries outside opts.Prefix, warned about once each
+	skipped   map[string]bool
+	found     bool
+	extracted int64
+	// the symlinks created so far, relative to destDir
+	links []string
+}
+
+func newExtractor(destDir string, opts ExtractOptions) *extractor {
+	return &extractor{destDir: destDir, opts: opts, folded: make(map[string]string), skipped: make(map[string]bool)}
+}
+
+// entry extracts the archive member described by header, whose content open returns.
+func (x *extractor) entry(header *tar.Header, open func() (io.ReadCloser, error)) error {
+	opts := x.opts
+	target, err := entryPath(x.destDir, header.Name, opts.AllowEscape)
+	if err != nil {
+		return withKind(ErrArchiveInvalid, err)
+	}
+	if opts.Prefix != "" {
+		top, _, _ := strings.Cut(strings.TrimLeft(path.Clean("/"+header.Name), "/"), "/")
+		if top != opts.Prefix {
+			if !x.skipped[top] {
+				x.skipped[top] = true
+				x.warnf("skipping %s in the archive, it is outside %s/", top, opts.Prefix)
+			}
+			return nil
+		}
+		x.found = true
+	}
+	if !keepEntry(header.Name, opts.Only) {
+		return nil
+	}
+	if err := x.checkCaseCollision(header.Name); err != nil {
+		return err
+	}
+	if err := x.checkParents(header.Name, target); err != nil {
+		return err
+	}
+	if opts.OnEntry != nil {
+		e := ArchiveEntry{
+			Name:    header.Name,
+			Size:    header.Size,
+			Mode:    os.FileMode(header.Mode).Perm(),
+			ModTime: header.ModTime,
+			Dir:     header.Typeflag == tar.TypeDir,
+		}
+		if err := opts.OnEntry(e); err != nil {
+			return err
+		}
+	}
+
+	switch header.Typeflag {
+	case tar.TypeDir:
+		mode := os.FileMode(0755)
+		if opts.PreserveMode {
+			mode = os.FileMode(header.Mode).Perm()
+		}
+		// the owner must be able to create the entries below it
+		mode = mode&^opts.ModeMask | 0700
+		// with Only set the entries of the parents may have been skipped
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := os.Mkdir(target, mode); err != nil && !os.IsExist(err) {
+			return err
+		}
+	case tar.TypeReg:
+		mode := os.FileMode(0644)
+		if opts.PreserveMode {
+			mode = os.FileMode(header.Mode)
+		}
+		mode &^= opts.ModeMask
+		// the header size is what the entry takes, however well it compressed
+		if x.extracted += header.Size; opts.MaxSize > 0 && x.extracted > opts.MaxSize {
+			return withKind(ErrArchiveInvalid, errors.Errorf("%s: the extracted files exceed %s, the archive is not a Go release or is a decompression bomb", header.Name, formatBytes(opts.MaxSize)))
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		r, err := open()
+		if err != nil {
+			return withKind(ErrArchiveInvalid, errors.Wrap(err, header.Name))
+		}
+		err = writeFileAtomic(target, r, mode, opts.Fsync)
+		r.Close()
+		if err != nil {
+			return err
+		}
+		if opts.PreserveModTime {
+			if err := os.Chtimes(target, header.ModTime, header.ModTime); err != nil {
+				return err
+			}
+		}
+	case tar.TypeSymlink:
+		if !opts.AllowEscape {
+			// the link is resolved from the directory holding it
+			rel := filepath.Join(filepath.Dir(header.Name), header.Linkname)
+			if filepath.IsAbs(header.Linkname) || hasDrive(header.Linkname) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				return x.skipLink(header, "points outside the archive")
+			}
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		os.Remove(target)
+		if err := os.Symlink(header.Linkname, target); err != nil {
+			return err
+		}
+		if !opts.AllowEscape {
+			if err := x.checkNewLink(header, target); err != nil {
+				return err
+			}
+		}
+	case tar.TypeLink:
+		// hard links name another entry of the archive
+		old, err := entryPath(x.destDir, header.Linkname, opts.AllowEscape)
+		if err == nil {
+			err = x.checkParents(header.Linkname, old)
+		}
+		if err == nil && !opts.AllowEscape {
+			// linking a symlink links whatever it points to on some systems
+			if info, lerr := os.Lstat(old); lerr == nil && info.Mode()&os.ModeSymlink != 0 {
+				err = errors.Errorf("%s is a symlink", header.Linkname)
+			}
+		}
+		if err != nil {
+			return x.skipLink(header, err.Error())
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		os.Remove(target)
+		if err := os.Link(old, target); err != nil {
+			return err
+		}
+	default:
+		if opts.Strict {
+			return withKind(ErrArchiveInvalid, errors.Errorf("%s: unsupported entry type %q", header.Name, header.Typeflag))
+		}
+		x.logger().Error("unknown type:", "type", header.Typeflag, "name", header.Name)
+	}
+	return nil
+}
+
+// checkParents refuses the entry name extracted to target when one of the
+// directories between destDir and target is a symlink on disk. The names are
+// checked one by one, but a symlink extracted earlier, say go/up -> .., turns an
+// innocent looking go/up/file into a path outside destDir.
+func (x *extractor) checkParents(name, target string) error {
+	if x.opts.AllowEscape {
+		return nil
+	}
+	rel, err := filepath.Rel(x.destDir, filepath.Dir(target))
+	if err != nil || rel == "." {
+		return err
+	}
+	dir := x.destDir
+	for _, seg := range strings.Split(rel, string(filepath.Separator)) {
+		dir = filepath.Join(dir, seg)
+		info, err := os.Lstat(dir)
+		if os.IsNotExist(err) {
+			// the rest is created as plain directories
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return withKind(ErrArchiveInvalid, errors.Errorf("archive entry %q goes through the symlink %s", name, dir))
+		}
+	}
+	return nil
+}
+
+// skipLink refuses the link entry header for the reason why, failing under
+// Strict and warning otherwise.
+func (x *extractor) skipLink(header *tar.Header, why string) error {
+	err := errors.Errorf("%s: link to %s %s", header.Name, header.Linkname, why)
+	if x.opts.Strict {
+		return withKind(ErrArchiveInvalid, err)
+	}
+	x.warnf("skipping %s", err)
+	return nil
+}
+
+// warnf warns through opts.Logger, or like the command when it is nil.
+func (x *extractor) warnf(format string, args ...any) {
+	transferSettings{log: x.opts.Logger}.warnf(format, args...)
+}
+
+// logger returns opts.Logger, or the logger of the run when it is nil.
+func (x *extractor) logger() *slog.Logger {
+	return transferSettings{log: x.opts.Logger}.logger()
+}
+
+// finish checks the archive as a whole once every entry was extracted.
+func (x *extractor) finish() error {
+	if x.opts.Prefix != "" && !x.found {
+		return withKind(ErrArchiveInvalid, errors.Errorf("the archive has no %s/ directory", x.opts.Prefix))
+	}
+	if x.opts.Fsync {
+		return syncTree(x.destDir)
+	}
+	return nil
+}
+
+// checkNewLink refuses the symlink just created at target for header when it, or
+// one of the links extracted before it, now resolves outside destDir. The target
+// was checked as text already, but a target such as l1/../.. climbs out through l1
+// if that is a link itself, possibly one extracted after it, so the links are
+// followed on disk. The refused link is removed before any later entry could be
+// written through it.
+func (x *extractor) checkNewLink(header *tar.Header, target string) error {
+	rel, err := filepath.Rel(x.destDir, target)
+	if err != nil {
+		return err
+	}
+	name := filepath.ToSlash(rel)
+	for _, l := range append(x.links, name) {
+		if x.inside(l) {
+			continue
+		}
+		if err := os.Remove(target); err != nil {
+			return err
+		}
+		if l == name {
+			return x.skipLink(header, "leads outside the archive")
+		}
+		return x.skipLink(header, "makes the link "+l+" lead outside the archive")
+	}
+	x.links = append(x.links, name)
+	return nil
+}
+
+// maxLinkHops bounds the symlinks followed resolving one path, like the kernel's
+// ELOOP limit.
+const maxLinkHops = 40
+
+// inside reports whether the slash separated name, relative to destDir, resolves
+// to a path within destDir, following the symlinks on disk like the kernel does.
+// Components that do not exist are taken as they are, they can only get created
+// as directories, and link loops count as leading outside.
+func (x *extractor) inside(name string) bool {
+	var stack []string
+	pending := strings.Split(name, "/")
+	hops := 0
+	for len(pending) > 0 {
+		c := pending[0]
+		pending = pending[1:]
+		switch c {
+		case "", ".":
+			continue
+		case "..":
+			if len(stack) == 0 {
+				return false
+			}
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		stack = append(stack, c)
+		p := filepath.Join(x.destDir, filepath.FromSlash(strings.Join(stack, "/")))
+		info, err := os.Lstat(p)
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+		link, err := os.Readlink(p)
+		if hops++; err != nil || hops > maxLinkHops || filepath.IsAbs(link) || hasDrive(link) {
+			return false
+		}
+		// the link is resolved from the directory holding it
+		stack = stack[:len(stack)-1]
+		pending = append(strings.Split(filepath.ToSlash(link), "/"), pending...)
+	}
+	return true
+}
+
+// checkCaseCollision records name in x.folded and reports an entry seen before
+// whose name differs from it only by case, as an error under Strict and a warning
+// otherwise.
+func (x *extractor) checkCaseCollision(name string) error {
+	folded := x.folded
+	clean := path.Clean("/" + name)
+	key := strings.ToLower(clean)
+	prev, ok := folded[key]
+	if !ok {
+		folded[key] = clean
+		return nil
+	}
+	if prev == clean {
+		return nil
+	}
+	if x.opts.Strict {
+		return withKind(ErrArchiveInvalid, errors.Errorf("archive entries %q and %q differ only by case", strings.TrimPrefix(prev, "/"), name))
+	}
+	x.warnf("archive entries %q and %q differ only by case and overwrite each other on case-insensitive filesystems", strings.TrimPrefix(prev, "/"), name)
+	return nil
+}
+
+// syncTree fsyncs root and every directory below it, so the entries created in
+// them are durable. The files themselves are synced as they are written.
+func syncTree(root string) error {
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return err
+		}
+		return syncDir(p)
+	})
+}
+
+// syncDir fsyncs the directory dir. Windows cannot sync directories and persists
+// renames without it, so it is a no-op there.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
+
+// entryPath returns where the archive member name is extracted to below destDir.
+// Unless allowEscape, absolute names, names with a drive or volume and names with
+// a .. segment are refused up front, whether or not joining them to destDir would
+// stay inside it, and so are names that still climb out of destDir.
+func entryPath(destDir, name string, allowEscape bool) (string, error) {
+	target := filepath.Join(destDir, name)
+	if allowEscape {
+		return target, nil
+	}
+	if filepath.IsAbs(name) || strings.HasPrefix(name, "/") || strings.HasPrefix(name, `\`) || hasDrive(name) {
+		return "", errors.Errorf("archive entry %q has an absolute path", name)
+	}
+	for _, seg := range strings.FieldsFunc(name, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if seg == ".." {
+			return "", errors.Errorf("archive entry %q has a .. path segment", name)
+		}
+	}
+	rel, err := filepath.Rel(destDir, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errors.Errorf("archive entry %q leads outside %s", name, destDir)
+	}
+	return target, nil
+}
+
+// hasDrive reports whether name starts with a Windows drive letter such as C:,
+// which filepath.IsAbs only recognizes on Windows.
+func hasDrive(name string) bool {
+	return len(name) >= 2 && name[1] == ':' &&
+		('a' <= name[0] && name[0] <= 'z' || 'A' <= name[0] && name[0] <= 'Z')
+}
+
+// writeFileAtomic copies r into a temporary file next to name and renames it into
+// place only once the copy completed, so an interrupted extraction never leaves a
+// partially written file under its final name. With sync the data is flushed to
+// disk before the rename. Whatever is at the temporary name already, such as a
+// symlink an archive placed there, is removed rather than written through.
+func writeFileAtomic(name string, r io.Reader, mode os.FileMode, sync bool) error {
+	tmp := name + ".tmp"
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	outFile, err := os.OpenFile(tmp, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(outFile, r); err != nil {
+		outFile.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if sync {
+		if err := outFile.Sync(); err != nil {
+			outFile.Close()
+			os.Remove(tmp)
+			return err
+		}
+	}
+	if err := outFile.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, name)
+}
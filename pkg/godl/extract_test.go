@@ -0,0 +1,552 @@
+package godl
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// testEntry is a member of an archive built by tarArchive or zipArchive.
+type testEntry struct {
+	Name     string
+	Type     byte
+	Linkname string
+	Body     string
+	// Mode is the permission bits of a file, 0644 when zero
+	Mode os.FileMode
+}
+
+func dirEntry(name string) testEntry {
+	return testEntry{Name: name, Type: tar.TypeDir}
+}
+
+func fileEntry(name, body string) testEntry {
+	return testEntry{Name: name, Type: tar.TypeReg, Body: body}
+}
+
+func symlinkEntry(name, target string) testEntry {
+	return testEntry{Name: name, Type: tar.TypeSymlink, Linkname: target}
+}
+
+// tarArchive returns a plain tarball of entries.
+func tarArchive(t *testing.T, entries ...testEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		h := &tar.Header{Name: e.Name, Typeflag: e.Type, Linkname: e.Linkname, Size: int64(len(e.Body)), Mode: 0644}
+		if e.Mode != 0 {
+			h.Mode = int64(e.Mode)
+		}
+		if e.Type == tar.TypeDir {
+			h.Mode = 0755
+		}
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.Body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// zipArchive returns a zip archive of entries; hard links have no zip form.
+func zipArchive(t *testing.T, entries ...testEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		h := &zip.FileHeader{Name: e.Name, Method: zip.Deflate}
+		body := e.Body
+		switch e.Type {
+		case tar.TypeDir:
+			h.Name += "/"
+			h.SetMode(os.ModeDir | 0755)
+		case tar.TypeSymlink:
+			h.SetMode(os.ModeSymlink | 0777)
+			body = e.Linkname
+		case tar.TypeReg:
+			h.SetMode(0644)
+			if e.Mode != 0 {
+				h.SetMode(e.Mode)
+			}
+		default:
+			t.Fatalf("%s: entry type %q has no zip form", e.Name, e.Type)
+		}
+		w, err := zw.CreateHeader(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// archiveFormats builds the same entries as each archive format.
+var archiveFormats = []struct {
+	filename string
+	build    func(*testing.T, ...testEntry) []byte
+}{
+	{"go.tar", tarArchive},
+	{"go.zip", zipArchive},
+}
+
+// extractTestArchive extracts data as filename into a directory of its own below
+// a fresh temporary directory, which it returns along with that parent, so that
+// anything escaping the destination can be looked for next to it.
+func extractTestArchive(t *testing.T, data []byte, filename string, opts ExtractOptions) (dest, parent string, err error) {
+	t.Helper()
+	parent = t.TempDir()
+	dest = filepath.Join(parent, "dest")
+	if err := os.Mkdir(dest, 0755); err != nil {
+		t.Fatal(err)
+	}
+	return dest, parent, ExtractArchive(bytes.NewReader(data), filename, dest, opts)
+}
+
+func TestExtractSymlinkChainEscape(t *testing.T) {
+	entries := []testEntry{
+		dirEntry("go"),
+		symlinkEntry("go/up", ".."),
+		symlinkEntry("go/up/up2", ".."),
+		fileEntry("go/up/up2/evil.txt", "pwned"),
+	}
+	for _, f := range archiveFormats {
+		for _, strict := range []bool{true, false} {
+			_, parent, err := extractTestArchive(t, f.build(t, entries...), f.filename, ExtractOptions{Strict: strict})
+			if err == nil {
+				t.Errorf("%s strict=%t: extracted an entry below a symlink", f.filename, strict)
+			}
+			if _, err := os.Lstat(filepath.Join(parent, "evil.txt")); err == nil {
+				t.Errorf("%s strict=%t: evil.txt was written outside the destination", f.filename, strict)
+			}
+			if _, err := os.Lstat(filepath.Join(parent, "up2")); err == nil {
+				t.Errorf("%s strict=%t: up2 was created outside the destination", f.filename, strict)
+			}
+		}
+	}
+}
+
+func TestExtractFileThroughSymlinkedDir(t *testing.T) {
+	entries := []testEntry{
+		dirEntry("go"),
+		symlinkEntry("go/lib", "."),
+		fileEntry("go/lib/file", "data"),
+	}
+	for _, f := range archiveFormats {
+		dest, _, err := extractTestArchive(t, f.build(t, entries...), f.filename, ExtractOptions{Strict: true})
+		if err == nil {
+			t.Errorf("%s: extracted an entry below a symlink", f.filename)
+		}
+		if _, err := os.Lstat(filepath.Join(dest, "go", "file")); err == nil {
+			t.Errorf("%s: go/file was written through go/lib", f.filename)
+		}
+	}
+}
+
+func TestExtractHardLinkThroughSymlink(t *testing.T) {
+	data := tarArchive(t,
+		dirEntry("go"),
+		symlinkEntry("go/up", ".."),
+		fileEntry("go/secret", "inside"),
+		testEntry{Name: "go/link", Type: tar.TypeLink, Linkname: "go/up/go/secret"},
+	)
+	dest, _, err := extractTestArchive(t, data, "go.tar", ExtractOptions{Strict: true})
+	if err == nil {
+		t.Fatal("hard link through a symlink was extracted")
+	}
+	if _, err := os.Lstat(filepath.Join(dest, "go", "link")); err == nil {
+		t.Error("go/link was created")
+	}
+
+	data = tarArchive(t,
+		dirEntry("go"),
+		symlinkEntry("go/alias", "secret"),
+		fileEntry("go/secret", "inside"),
+		testEntry{Name: "go/link", Type: tar.TypeLink, Linkname: "go/alias"},
+	)
+	if _, _, err := extractTestArchive(t, data, "go.tar", ExtractOptions{Strict: true}); err == nil {
+		t.Error("hard link to a symlink was extracted")
+	}
+}
+
+func TestExtractSymlinksInside(t *testing.T) {
+	entries := []testEntry{
+		dirEntry("go"),
+		dirEntry("go/bin"),
+		fileEntry("go/bin/go", "binary"),
+		symlinkEntry("go/gobin", "bin/go"),
+		dirEntry("go/pkg"),
+		symlinkEntry("go/pkg/tool", "../bin"),
+	}
+	for _, f := range archiveFormats {
+		dest, _, err := extractTestArchive(t, f.build(t, entries...), f.filename, ExtractOptions{Strict: true})
+		if err != nil {
+			t.Fatalf("%s: %v", f.filename, err)
+		}
+		b, err := os.ReadFile(filepath.Join(dest, "go", "pkg", "tool", "go"))
+		if err != nil || string(b) != "binary" {
+			t.Errorf("%s: go/pkg/tool/go = %q, %v", f.filename, b, err)
+		}
+		if target, err := os.Readlink(filepath.Join(dest, "go", "gobin")); err != nil || target != "bin/go" {
+			t.Errorf("%s: go/gobin -> %q, %v", f.filename, target, err)
+		}
+	}
+}
+
+func TestExtractTraversalNames(t *testing.T) {
+	for _, name := range []string{"../evil.txt", "go/../../evil.txt", "/evil.txt", `go\..\..\evil.txt`, "C:/evil.txt"} {
+		for _, f := range archiveFormats {
+			_, parent, err := extractTestArchive(t, f.build(t, dirEntry("go"), fileEntry(name, "pwned")), f.filename, ExtractOptions{})
+			if err == nil {
+				t.Errorf("%s: entry %q was extracted", f.filename, name)
+			} else if !errors.Is(err, ErrArchiveInvalid) {
+				t.Errorf("%s: entry %q: got %v, want ErrArchiveInvalid", f.filename, name, err)
+			}
+			if _, err := os.Lstat(filepath.Join(parent, "evil.txt")); err == nil {
+				t.Errorf("%s: entry %q was written outside the destination", f.filename, name)
+			}
+		}
+	}
+}
+
+func TestExtractLinksOutside(t *testing.T) {
+	for _, target := range []string{"/etc/passwd", "../..", "../../dest", "C:/Windows"} {
+		for _, f := range archiveFormats {
+			data := f.build(t, dirEntry("go"), symlinkEntry("go/link", target))
+			if _, _, err := extractTestArchive(t, data, f.filename, ExtractOptions{Strict: true}); err == nil {
+				t.Errorf("%s: strict extraction kept a link to %s", f.filename, target)
+			}
+			dest, _, err := extractTestArchive(t, data, f.filename, ExtractOptions{})
+			if err != nil {
+				t.Errorf("%s: link to %s: %v", f.filename, target, err)
+			}
+			if _, err := os.Lstat(filepath.Join(dest, "go", "link")); err == nil {
+				t.Errorf("%s: link to %s was extracted", f.filename, target)
+			}
+		}
+	}
+
+	data := tarArchive(t, dirEntry("go"), testEntry{Name: "go/link", Type: tar.TypeLink, Linkname: "../outside"})
+	if _, _, err := extractTestArchive(t, data, "go.tar", ExtractOptions{Strict: true}); err == nil {
+		t.Error("hard link outside the archive was extracted")
+	}
+}
+
+func TestExtractLinkThroughLaterLink(t *testing.T) {
+	// l2 stays in the archive as long as l1 is a directory, but l1 turns it into a
+	// link to the parent of the destination, so l1 is refused when it comes
+	entries := []testEntry{
+		dirEntry("go"),
+		symlinkEntry("go/l2", "l1/../.."),
+		symlinkEntry("go/l1", "."),
+	}
+	for _, f := range archiveFormats {
+		if _, _, err := extractTestArchive(t, f.build(t, entries...), f.filename, ExtractOptions{Strict: true}); err == nil {
+			t.Errorf("%s: strict extraction kept go/l1", f.filename)
+		}
+		dest, _, err := extractTestArchive(t, f.build(t, entries...), f.filename, ExtractOptions{})
+		if err != nil {
+			t.Fatalf("%s: %v", f.filename, err)
+		}
+		if _, err := os.Lstat(filepath.Join(dest, "go", "l1")); err == nil {
+			t.Errorf("%s: go/l1 was kept", f.filename)
+		}
+		if _, err := os.Lstat(filepath.Join(dest, "go", "l2")); err != nil {
+			t.Errorf("%s: go/l2 was removed: %v", f.filename, err)
+		}
+	}
+}
+
+func TestExtractRefusesLinkChainAtEntry(t *testing.T) {
+	// go/a is refused as it is extracted, so go/c/d only dangles inside the tree
+	entries := []testEntry{
+		dirEntry("go"),
+		symlinkEntry("go/b", "."),
+		symlinkEntry("go/a", "b/../.."),
+		dirEntry("go/c"),
+		symlinkEntry("go/c/d", "../a/x"),
+	}
+	for _, f := range archiveFormats {
+		if _, _, err := extractTestArchive(t, f.build(t, entries...), f.filename, ExtractOptions{Strict: true}); err == nil || !strings.Contains(err.Error(), "go/a") {
+			t.Errorf("%s: strict extraction: %v, want go/a refused", f.filename, err)
+		}
+		dest, _, err := extractTestArchive(t, f.build(t, entries...), f.filename, ExtractOptions{})
+		if err != nil {
+			t.Fatalf("%s: %v", f.filename, err)
+		}
+		for name, kept := range map[string]bool{"go/b": true, "go/a": false, "go/c/d": true} {
+			if _, err := os.Lstat(filepath.Join(dest, filepath.FromSlash(name))); (err == nil) != kept {
+				t.Errorf("%s: %s kept: %v, want %v", f.filename, name, err == nil, kept)
+			}
+		}
+	}
+}
+
+func TestExtractFileThroughTempLink(t *testing.T) {
+	// go/x.tmp is where go/x is written first, and leads out of the destination
+	entries := []testEntry{
+		dirEntry("go"),
+		symlinkEntry("go/b", "."),
+		symlinkEntry("go/a", "b/../.."),
+		symlinkEntry("go/x.tmp", "a/evil"),
+		fileEntry("go/x", "pwned"),
+	}
+	for _, f := range archiveFormats {
+		for _, strict := range []bool{false, true} {
+			dest, parent, _ := extractTestArchive(t, f.build(t, entries...), f.filename, ExtractOptions{Strict: strict})
+			if _, err := os.Lstat(filepath.Join(parent, "evil")); err == nil {
+				t.Errorf("%s, strict %v: go/x was written outside the destination", f.filename, strict)
+			}
+			if b, err := os.ReadFile(filepath.Join(dest, "go", "x")); !strict && (err != nil || string(b) != "pwned") {
+				t.Errorf("%s: go/x has %q, %v, want pwned", f.filename, b, err)
+			}
+		}
+	}
+}
+
+// failingReader returns n bytes of data and then fails, like a download cut short.
+type failingReader struct{ n int }
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.n == 0 {
+		return 0, errors.New("connection reset")
+	}
+	n := min(len(p), r.n)
+	r.n -= n
+	return n, nil
+}
+
+func TestWriteFileAtomicAbort(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "go")
+	if err := writeFileAtomic(name, &failingReader{n: 1 << 16}, 0755, false); err == nil {
+		t.Fatal("an interrupted copy succeeded")
+	}
+	for _, p := range []string{name, name + ".tmp"} {
+		if _, err := os.Lstat(p); err == nil {
+			t.Errorf("%s exists after an interrupted copy", p)
+		}
+	}
+
+	// an interrupted copy over an existing file leaves it as it was
+	if err := os.WriteFile(name, []byte("old"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(name, &failingReader{n: 10}, 0755, true); err == nil {
+		t.Fatal("an interrupted copy succeeded")
+	}
+	if b, err := os.ReadFile(name); err != nil || string(b) != "old" {
+		t.Errorf("%s has %q, %v after an interrupted copy, want old", name, b, err)
+	}
+}
+
+func TestExtractAbortLeavesNoPartialFile(t *testing.T) {
+	data := tarArchive(t, dirEntry("go"), dirEntry("go/bin"), fileEntry("go/bin/go", strings.Repeat("x", 1<<16)))
+	// cut the archive in the middle of go/bin/go
+	r := io.MultiReader(bytes.NewReader(data[:len(data)/2]), &failingReader{})
+	dest := t.TempDir()
+	if err := ExtractArchive(r, "go.tar", dest, ExtractOptions{}); err == nil {
+		t.Fatal("a truncated archive extracted")
+	}
+	entries, err := os.ReadDir(filepath.Join(dest, "go", "bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		t.Errorf("go/bin/%s was left by the interrupted extraction", e.Name())
+	}
+}
+
+func TestEntryPathRejectsAbsoluteAndDotDot(t *testing.T) {
+	dest := t.TempDir()
+	for _, name := range []string{
+		"/etc/passwd",
+		`\Windows\System32`,
+		"C:/Windows",
+		"c:evil",
+		"../etc/passwd",
+		"go/../../etc/passwd",
+		// these stay inside dest once joined, but are refused all the same
+		"go/../go/bin/go",
+		`go\..\go\bin\go`,
+		"go/bin/..",
+	} {
+		if p, err := entryPath(dest, name, false); err == nil {
+			t.Errorf("entryPath(%q) = %s, want an error", name, p)
+		}
+	}
+	for name, want := range map[string]string{
+		"go/bin/go":    filepath.Join(dest, "go", "bin", "go"),
+		"./go/VERSION": filepath.Join(dest, "go", "VERSION"),
+		"go/..hidden":  filepath.Join(dest, "go", "..hidden"),
+	} {
+		if p, err := entryPath(dest, name, false); err != nil || p != want {
+			t.Errorf("entryPath(%q) = %s, %v, want %s", name, p, err, want)
+		}
+	}
+	// AllowEscape takes the names as they are
+	if p, err := entryPath(dest, "../outside", true); err != nil || p != filepath.Join(filepath.Dir(dest), "outside") {
+		t.Errorf("entryPath(../outside) with AllowEscape = %s, %v", p, err)
+	}
+}
+
+func TestExtractCaseCollision(t *testing.T) {
+	entries := []testEntry{
+		dirEntry("go"),
+		fileEntry("go/src/Makefile", "upper"),
+		fileEntry("go/src/makefile", "lower"),
+	}
+	for _, f := range archiveFormats {
+		_, _, err := extractTestArchive(t, f.build(t, entries...), f.filename, ExtractOptions{Strict: true})
+		if !errors.Is(err, ErrArchiveInvalid) || !strings.Contains(err.Error(), "differ only by case") {
+			t.Errorf("%s strict: %v, want a case collision error", f.filename, err)
+		}
+		// without Strict it is only a warning
+		dest, _, err := extractTestArchive(t, f.build(t, entries...), f.filename, ExtractOptions{})
+		if err != nil {
+			t.Errorf("%s: %v", f.filename, err)
+		}
+		if _, err := os.Stat(filepath.Join(dest, "go", "src", "makefile")); err != nil {
+			t.Errorf("%s: %v", f.filename, err)
+		}
+	}
+	// the same name twice, or names differing beyond case, are fine
+	for _, names := range [][]string{{"go/a", "go/./a"}, {"go/a", "go/b"}, {"go/bin", "go/Bin2"}} {
+		x := &extractor{folded: map[string]string{}, opts: ExtractOptions{Strict: true}}
+		for _, name := range names {
+			if err := x.checkCaseCollision(name); err != nil {
+				t.Errorf("%v: %v", names, err)
+			}
+		}
+	}
+}
+
+func TestCountArchiveEntries(t *testing.T) {
+	entries := []testEntry{
+		dirEntry("go"), dirEntry("go/bin"), fileEntry("go/bin/go", "#!/bin/sh\n"),
+		symlinkEntry("go/gofmt", "bin/go"), fileEntry("go/VERSION", "go1.22.1\n"),
+	}
+	archives := map[string][]byte{"go.tar.gz": gzipped(t, tarArchive(t, entries...))}
+	for _, f := range archiveFormats {
+		archives[f.filename] = f.build(t, entries...)
+	}
+	for filename, data := range archives {
+		// temporary downloads carry a random suffix, the format comes from the file name
+		p := filepath.Join(t.TempDir(), filename+"123456")
+		if err := os.WriteFile(p, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		for _, tt := range []struct {
+			only []string
+			want int
+		}{{nil, 5}, {[]string{"go/bin"}, 2}, {[]string{"go/VERSION", "go/gofmt"}, 2}} {
+			if n, err := countArchiveEntries(p, filename, tt.only); err != nil || n != tt.want {
+				t.Errorf("%s only %v: %d entries, %v, want %d", filename, tt.only, n, err, tt.want)
+			}
+		}
+	}
+}
+
+// gzipped returns data gzip compressed.
+func gzipped(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	if _, err := gw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractGzipAndTarErrors(t *testing.T) {
+	tarball := tarArchive(t, dirEntry("go"), fileEntry("go/VERSION", "go1.22.1\n"), fileEntry("go/bin/go", strings.Repeat("binary", 4096)))
+	gz := gzipped(t, tarball)
+	corrupt := bytes.Clone(gz)
+	// flip a bit of the CRC-32 in the trailer
+	corrupt[len(corrupt)-8] ^= 1
+	for _, tt := range []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"truncated gzip", gz[:len(gz)/2], "corrupt gzip stream"},
+		{"gzip checksum", corrupt, "corrupt gzip stream"},
+		{"not gzip", tarball, "invalid gzip stream"},
+		{"truncated tar in a header", gzipped(t, tarball[:512+100]), "malformed tar archive"},
+		{"truncated tar in a file", gzipped(t, tarball[:len(tarball)/2]), "malformed tar archive"},
+	} {
+		err := ExtractArchive(bytes.NewReader(tt.data), "go.tar.gz", t.TempDir(), ExtractOptions{})
+		if !errors.Is(err, ErrArchiveInvalid) || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: %v, want an ErrArchiveInvalid %q", tt.name, err, tt.want)
+		}
+	}
+	if err := ExtractArchive(bytes.NewReader(gz), "go.tar.gz", t.TempDir(), ExtractOptions{}); err != nil {
+		t.Errorf("intact archive: %v", err)
+	}
+}
+
+func TestExtractZip(t *testing.T) {
+	data := zipArchive(t,
+		dirEntry("go"),
+		fileEntry("go/VERSION", "go1.22.1\n"),
+		testEntry{Name: "go/bin/go.exe", Type: tar.TypeReg, Body: "MZ", Mode: 0755},
+		// no directory entries for these parents
+		fileEntry("go/pkg/tool/windows_amd64/compile.exe", "MZ compile"),
+		dirEntry("go/misc/empty"),
+	)
+	dest := t.TempDir()
+	if err := extractZip(bytes.NewReader(data), int64(len(data)), dest, ExtractOptions{PreserveMode: true}); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"go/VERSION":                            "go1.22.1\n",
+		"go/bin/go.exe":                         "MZ",
+		"go/pkg/tool/windows_amd64/compile.exe": "MZ compile",
+	} {
+		b, err := os.ReadFile(filepath.Join(dest, filepath.FromSlash(name)))
+		if err != nil || string(b) != want {
+			t.Errorf("%s = %q, %v, want %q", name, b, err, want)
+		}
+	}
+	if info, err := os.Stat(filepath.Join(dest, "go", "misc", "empty")); err != nil || !info.IsDir() {
+		t.Errorf("go/misc/empty: %v, want a directory", err)
+	}
+	if runtime.GOOS != "windows" {
+		for name, want := range map[string]os.FileMode{"go/bin/go.exe": 0755, "go/VERSION": 0644} {
+			info, err := os.Stat(filepath.Join(dest, filepath.FromSlash(name)))
+			if err != nil {
+				t.Error(err)
+			} else if info.Mode().Perm() != want {
+				t.Errorf("%s has mode %v, want %v", name, info.Mode().Perm(), want)
+			}
+		}
+	}
+	// ExtractArchive picks the zip format from the name, whatever its case
+	if err := ExtractArchive(bytes.NewReader(data), "go1.22.1.windows-amd64.ZIP", t.TempDir(), ExtractOptions{}); err != nil {
+		t.Errorf("ExtractArchive: %v", err)
+	}
+	if err := ExtractArchive(bytes.NewReader(data[:len(data)/2]), "go.zip", t.TempDir(), ExtractOptions{}); !errors.Is(err, ErrArchiveInvalid) {
+		t.Errorf("truncated zip: %v, want ErrArchiveInvalid", err)
+	}
+}
@@ -0,0 +1,154 @@
+package godl
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	githubAPI = "https://api.github.com"
+	// githubMaxPages bounds the pages of 100 releases read from the releases API.
+	githubMaxPages = 10
+)
+
+// githubRelease is the part of a GitHub releases API entry godl uses.
+type githubRelease struct {
+	TagName    string        `json:"tag_name"`
+	Draft      bool          `json:"draft"`
+	Prerelease bool          `json:"prerelease"`
+	Assets     []githubAsset `json:"assets"`
+}
+
+type githubAsset struct {
+	Name string `json:"name"`
+	Size int    `json:"size"`
+	// Digest is "sha256:<hex>" on assets uploaded since GitHub started recording it.
+	Digest string `json:"digest"`
+}
+
+// githubDownloadURL returns the base URL the release files of repo are
+// downloaded from; file names are <tag>/<asset>.
+func githubDownloadURL(repo string) string {
+	return "https://github.com/" + repo + "/releases/download/"
+}
+
+// fetchGitHubReleases reads the releases of repo, e.g. example/go-mirror, from the
+// GitHub releases API and maps their assets named like the go.dev release files
+// to Files. token is sent as a bearer token when set, which raises the rate limit.
+func fetchGitHubReleases(ctx context.Context, repo, token string) ([]Release, error) {
+	h := map[string]string{
+		"Accept":               "application/vnd.github+json",
+		"X-GitHub-Api-Version": "2022-11-28",
+	}
+	if token != "" {
+		h["Authorization"] = "Bearer " + token
+	}
+	var rs []Release
+	for page := 1; page <= githubMaxPages; page++ {
+		u := githubAPI + "/repos/" + repo + "/releases?per_page=100&page=" + strconv.Itoa(page)
+		c, err := httpGetHeaders(ctx, u, h)
+		if err != nil {
+			return nil, err
+		}
+		if err := githubRateLimited(c.StatusCode(), c.Headers()); err != nil {
+			return nil, err
+		}
+		if c.StatusCode() != http.StatusOK {
+			return nil, errors.Errorf("%s returned status %d, body: %s", u, c.StatusCode(), bodySnippet(c.Body()))
+		}
+		var grs []githubRelease
+		if err := json.Unmarshal(c.Body(), &grs); err != nil {
+			return nil, errors.Wrapf(err, "decode GitHub releases from %s", u)
+		}
+		for _, gr := range grs {
+			if r, ok := githubToRelease(gr); ok {
+				rs = append(rs, r)
+			}
+		}
+		if len(grs) < 100 {
+			break
+		}
+	}
+	if err := validateReleases(rs); err != nil {
+		return nil, errors.Wrapf(err, "releases of %s", repo)
+	}
+	if len(rs) == 0 {
+		return nil, errors.Errorf("%s has no releases with go release files", repo)
+	}
+	return rs, nil
+}
+
+// githubRateLimited returns an error naming the reset time when the API refused
+// the request because the rate limit is used up. 429s are retried by httpGet.
+func githubRateLimited(status int, h http.Header) error {
+	if status != http.StatusForbidden || h.Get("X-RateLimit-Remaining") != "0" {
+		return nil
+	}
+	msg := "GitHub API rate limit exceeded"
+	if reset, err := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		msg += ", it resets at " + time.Unix(reset, 0).Format(time.RFC3339)
+	}
+	return errors.New(msg + "; set -github-token to raise it")
+}
+
+// githubToRelease maps the assets of gr to release files. Drafts and releases
+// without any go release file are skipped.
+func githubToRelease(gr githubRelease) (Release, bool) {
+	if gr.Draft {
+		return Release{}, false
+	}
+	r := Release{Stable: !gr.Prerelease}
+	for _, a := range gr.Assets {
+		f, ok := parseReleaseFilename(a.Name)
+		if !ok {
+			continue
+		}
+		f.Filename = url.PathEscape(gr.TagName) + "/" + a.Name
+		f.Size = a.Size
+		f.Sha256 = strings.TrimPrefix(a.Digest, "sha256:")
+		if f.Sha256 == a.Digest {
+			f.Sha256 = ""
+		}
+		r.Version = f.Version
+		r.Files = append(r.Files, f)
+	}
+	return r, len(r.Files) > 0
+}
+
+// parseReleaseFilename parses a go.dev release file name such as
+// go1.22.9.linux-amd64.tar.gz or go1.22.9.src.tar.gz.
+func parseReleaseFilename(name string) (File, bool) {
+	ext := ""
+	for _, e := range archiveExts {
+		if strings.HasSuffix(name, e) {
+			ext = e
+			break
+		}
+	}
+	base := strings.TrimSuffix(name, ext)
+	i := strings.LastIndex(base, ".")
+	if ext == "" || i < 0 || !versionPattern.MatchString(base[:i]) {
+		return File{}, false
+	}
+	f := File{Filename: name, Version: base[:i], Kind: "archive"}
+	if ext == ".pkg" || ext == ".msi" {
+		f.Kind = "installer"
+	}
+	if platform := base[i+1:]; platform == "src" {
+		f.Kind = "source"
+	} else {
+		osArch := strings.SplitN(platform, "-", 2)
+		if len(osArch) != 2 {
+			return File{}, false
+		}
+		f.Os, f.Arch = osArch[0], osArch[1]
+	}
+	return f, true
+}
@@ -0,0 +1,104 @@
+package godl
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// goVersionFile is the file version managers such as goenv read the Go version
+// of a project from.
+const goVersionFile = ".go-version"
+
+// goVersionPattern matches the versions a .go-version file may hold without the
+// go prefix, e.g. 1.22, 1.22.9 or 1.23rc1.
+var goVersionPattern = regexp.MustCompile(`^1(\.[0-9]+){0,2}((rc|beta)[0-9]+)?$`)
+
+// findGoVersion looks for the version a project pins in dir and its parents,
+// stopping at the root of the repository, the first directory with a .git entry,
+// and returns the path of the file naming it and the version. In each directory a
+// .go-version file is preferred over the toolchain line of go.mod; a go.mod
+// without one does not pin a version.
+func findGoVersion(start string) (string, string, error) {
+	dir := start
+	for {
+		p := filepath.Join(dir, goVersionFile)
+		if _, err := os.Stat(p); err == nil {
+			v, err := readGoVersion(p)
+			return p, v, err
+		}
+		p = filepath.Join(dir, "go.mod")
+		if v, err := readToolchain(p); err != nil || v != "" {
+			return p, v, err
+		}
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	return "", "", errors.Errorf("no %s file or go.mod toolchain line found in %s or its parents", goVersionFile, start)
+}
+
+// readToolchain returns the version of the toolchain directive of the go.mod file
+// at path, e.g. go1.22.9 for "toolchain go1.22.9", and empty when the file is
+// missing or has no such line.
+func readToolchain(path string) (string, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 2 || fields[0] != "toolchain" {
+			continue
+		}
+		v := strings.TrimPrefix(fields[1], "go")
+		if v == "default" || v == "local" {
+			return "", nil
+		}
+		if !goVersionPattern.MatchString(v) {
+			return "", errors.Errorf("%s: toolchain %q is not a Go version such as go1.22.9", path, fields[1])
+		}
+		return "go" + v, nil
+	}
+	return "", s.Err()
+}
+
+// readGoVersion returns the version in the .go-version file at path, the first
+// line that is neither empty nor a # comment, as a go1 version.
+func readGoVersion(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		v := strings.TrimPrefix(line, "go")
+		if !goVersionPattern.MatchString(v) {
+			return "", errors.Errorf("%s: %q is not a Go version such as 1.22.9 or go1.22.9", path, line)
+		}
+		return "go" + v, nil
+	}
+	if err := s.Err(); err != nil {
+		return "", err
+	}
+	return "", errors.Errorf("%s names no version", path)
+}
@@ -0,0 +1,117 @@
+package godl
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/execabs"
+)
+
+// hookEnviron returns the environment passed to the install hooks.
+func hookEnviron(version, goRoot, backup string) []string {
+	return append(os.Environ(),
+		"GODL_VERSION="+version,
+		"GODL_GOROOT="+goRoot,
+		"GODL_BACKUP="+backup,
+	)
+}
+
+// toolchainEnviron returns the environment of the post-hooks and the cache warming:
+// the hook environment with the toolchain at goRoot first on PATH and selected by
+// GOROOT, and GOTOOLCHAIN=local so that it is the go command that runs.
+func toolchainEnviron(version, goRoot, backup string) []string {
+	return append(hookEnviron(version, goRoot, backup),
+		"GOROOT="+goRoot,
+		"PATH="+filepath.Join(goRoot, "bin")+string(os.PathListSeparator)+os.Getenv("PATH"),
+		"GOTOOLCHAIN=local",
+	)
+}
+
+// warmVariants maps the -warm-cache variants to the arguments and environment of
+// the go build std they run.
+var warmVariants = map[string]struct {
+	args []string
+	env  string
+}{
+	"std":          {args: []string{"build", "std"}},
+	"race":         {args: []string{"build", "-race", "std"}},
+	"boringcrypto": {args: []string{"build", "std"}, env: "GOEXPERIMENT=boringcrypto"},
+}
+
+// validateWarmCache checks the variants of -warm-cache.
+func validateWarmCache() error {
+	for _, v := range warmCacheList() {
+		if _, ok := warmVariants[v]; !ok {
+			return errors.Errorf("invalid -warm-cache variant %q, want std, race or boringcrypto", v)
+		}
+	}
+	return nil
+}
+
+// warmCacheList returns the comma separated variants of -warm-cache.
+func warmCacheList() []string {
+	var list []string
+	for _, v := range strings.Split(warmCache, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// afterInstall rebuilds the standard library variants of -warm-cache into the
+// build cache with the new toolchain at goRoot, then runs the -post-hook commands
+// with it, for example to reinstall the tools built with the previous version.
+// Failures are warnings; the toolchain is installed and working by then.
+func afterInstall(ctx context.Context, version, goRoot, backup string) {
+	env := toolchainEnviron(version, goRoot, backup)
+	goBin := filepath.Join(goRoot, "bin", "go")
+	if runtime.GOOS == "windows" {
+		goBin += ".exe"
+	}
+	for _, v := range warmCacheList() {
+		w := warmVariants[v]
+		fmt.Fprintf(stdout, "warming the build cache: go %s\n", strings.Join(w.args, " "))
+		c := execabs.CommandContext(ctx, goBin, w.args...)
+		c.Env = env
+		if w.env != "" {
+			c.Env = append(c.Env, w.env)
+		}
+		c.Stdout = stdout
+		c.Stderr = os.Stderr
+		if err := c.Run(); err != nil {
+			warnf("warm the build cache (%s): %s", v, err)
+		}
+	}
+	for _, h := range postHooks {
+		fmt.Fprintf(stdout, "post-hook: %s\n", h)
+		if err := runHook(ctx, h, env); err != nil {
+			warnf("post-hook failed: %s", err)
+		}
+	}
+}
+
+// runHook runs command through the system shell with env, forwarding its output.
+func runHook(ctx context.Context, command string, env []string) error {
+	var c *execabs.Cmd
+	if runtime.GOOS == "windows" {
+		c = execabs.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		c = execabs.CommandContext(ctx, "sh", "-c", command)
+	}
+	c.Env = env
+	settings := settingsOf(ctx)
+	c.Stdout, c.Stderr = settings.out, os.Stderr
+	if settings.client {
+		c.Stderr = settings.out
+	}
+	if err := c.Run(); err != nil {
+		return errors.Wrapf(err, "run %q", command)
+	}
+	return nil
+}
@@ -0,0 +1,422 @@
+package godl
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/e2u/e2util/e2http"
+	"github.com/pkg/errors"
+)
+
+const (
+	// maxRetryBackoff caps the pause between two attempts of -retries.
+	maxRetryBackoff = 30 * time.Second
+	// maxRateLimitWaits bounds how often a single request waits out a 429.
+	maxRateLimitWaits = 5
+	// defaultRetryAfter is used when a 429 response carries no usable Retry-After.
+	defaultRetryAfter = 10 * time.Second
+)
+
+// httpGet fetches u, waiting and asking again while the server answers 429 Too Many
+// Requests. Waits never extend past the deadline of ctx.
+func httpGet(ctx context.Context, u string) (*e2http.Context, error) {
+	return httpGetHeaders(ctx, u, nil)
+}
+
+// httpGetHeaders is httpGet sending the extra request headers h.
+func httpGetHeaders(ctx context.Context, u string, h map[string]string) (*e2http.Context, error) {
+	var c *e2http.Context
+	ctx, done := traceRequest(ctx, u)
+	defer done()
+	err := withRetries(ctx, u, func(ctx context.Context) error {
+		for waits := 0; ; waits++ {
+			c = e2http.Builder(ctx).URL(u).SetHeaders(h).Do()
+			if errs := c.Errors(); len(errs) > 0 {
+				return errs[0]
+			}
+			if c.StatusCode() >= 500 {
+				return &statusError{URL: u, Code: c.StatusCode()}
+			}
+			if c.StatusCode() != http.StatusTooManyRequests {
+				return nil
+			}
+			if err := waitRateLimited(ctx, u, c.Headers(), waits); err != nil {
+				return permanent(err)
+			}
+		}
+	})
+	return c, err
+}
+
+// statusError is an unexpected HTTP status; 5xx statuses are retried.
+type statusError struct {
+	URL  string
+	Code int
+}
+
+func (e *statusError) Error() string { return fmt.Sprintf("%s returned status %d", e.URL, e.Code) }
+
+// permanentError is an error -retries must not retry.
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+func permanent(err error) error { return &permanentError{err: err} }
+
+// transferSettings are what the requests, downloads and installs made with a
+// context take from the command's flags, or from the Client making them.
+type transferSettings struct {
+	// retries is how often a failed request is retried
+	retries int
+	// maxArchiveMiB is the largest file downloaded, in MiB, 0 meaning no limit
+	maxArchiveMiB int
+	// attemptTimeout bounds each attempt of a request, 0 meaning no limit
+	attemptTimeout time.Duration
+	// resume continues a failed download with a Range request
+	resume bool
+	// metaCacheDir caches the release lists, empty disables the cache, and copies
+	// younger than metaCacheTTL are used without asking the server
+	metaCacheDir string
+	metaCacheTTL time.Duration
+	offline      bool
+	trace        bool
+	// out receives the human readable progress
+	out io.Writer
+	// log receives the warnings, records and events instead of warnf, logger and
+	// emit when set
+	log *slog.Logger
+	// client marks the work of a Client: its requests go through the transport
+	// net/http was set up with rather than the one configureTransport built from
+	// the flags, and its downloads are not counted in the metrics of the run
+	client bool
+}
+
+type settingsKey struct{}
+
+// withSettings returns a context whose requests and installs keep to s instead of
+// the flags.
+func withSettings(ctx context.Context, s transferSettings) context.Context {
+	return context.WithValue(ctx, settingsKey{}, s)
+}
+
+// settingsOf returns the settings of ctx, the flags unless withSettings set others.
+func settingsOf(ctx context.Context) transferSettings {
+	if s, ok := ctx.Value(settingsKey{}).(transferSettings); ok {
+		return s
+	}
+	return transferSettings{
+		retries:        retries,
+		maxArchiveMiB:  maxArchiveMiB,
+		attemptTimeout: attemptTimeout,
+		resume:         resumeDownload,
+		metaCacheDir:   metaCacheDir,
+		metaCacheTTL:   metaCacheTTL,
+		offline:        offline,
+		trace:          traceHTTP,
+		out:            stdout,
+	}
+}
+
+// warnf is the package warnf, or a warning record of s.log.
+func (s transferSettings) warnf(format string, args ...any) {
+	if s.log != nil {
+		s.log.Warn(fmt.Sprintf(format, args...))
+		return
+	}
+	warnf(format, args...)
+}
+
+// logger returns s.log, or the logger of the run.
+func (s transferSettings) logger() *slog.Logger {
+	if s.log != nil {
+		return s.log
+	}
+	return logger
+}
+
+// emit is the package emit, or a record of e in s.log.
+func (s transferSettings) emit(e streamEvent) {
+	if s.log != nil {
+		s.log.Info(e.Event, "event", e)
+		return
+	}
+	emit(e)
+}
+
+// httpClient returns the client the requests of s are made with.
+func (s transferSettings) httpClient() *http.Client {
+	if s.client {
+		return plainClient
+	}
+	return http.DefaultClient
+}
+
+// plainClient makes the requests of a Client, whose requests the transport built by
+// configureTransport passes on untouched, see redirectGuard.
+var plainClient = &http.Client{}
+
+// withRetries runs attempt and, as long as it fails with a retryable error, up to
+// the retries of settingsOf(ctx) more times with a growing pause in between. Two
+// deadlines compose: ctx, bounded by -timeout, limits all attempts and pauses
+// together, while each attempt also gets its own context bounded by
+// -timeout-per-retry, so that one stalled connection is abandoned and retried
+// instead of using up the whole -timeout.
+func withRetries(ctx context.Context, what string, attempt func(ctx context.Context) error) error {
+	settings := settingsOf(ctx)
+	retries := settings.retries
+	for try := 0; ; try++ {
+		actx, cancel := ctx, context.CancelFunc(func() {})
+		if settings.attemptTimeout > 0 {
+			actx, cancel = context.WithTimeout(ctx, settings.attemptTimeout)
+		}
+		err := attempt(actx)
+		cancel()
+		if err == nil || try >= retries || ctx.Err() != nil || !retryable(err) {
+			var p *permanentError
+			if errors.As(err, &p) {
+				return p.err
+			}
+			return err
+		}
+		wait := min(time.Duration(1<<try)*time.Second, maxRetryBackoff)
+		settings.warnf("%s: %s, retrying in %s (%d/%d)", what, err, wait, try+1, retries)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// retryable reports whether err may go away when the request is repeated: network
+// errors, timeouts of a single attempt and 5xx statuses are, other statuses and
+// permanent errors are not.
+func retryable(err error) bool {
+	var p *permanentError
+	var s *statusError
+	switch {
+	case errors.As(err, &p):
+		return false
+	case errors.As(err, &s):
+		return s.Code >= 500
+	}
+	return true
+}
+
+// downloadFile downloads u into f like download. A retry continues after the bytes
+// the failed attempt left in f with a Range request, or with -resume=false starts
+// over with an emptied f. Servers that ignore the range, or whose file changed in
+// between, send it whole and f is emptied then.
+func downloadFile(ctx context.Context, u string, f *os.File, size int64, progress ProgressFunc) (int64, error) {
+	var n int64
+	var validator string
+	restart := func() error {
+		if err := f.Truncate(0); err != nil {
+			return err
+		}
+		_, err := f.Seek(0, io.SeekStart)
+		return err
+	}
+	err := withRetries(ctx, u, func(ctx context.Context) error {
+		offset, err := f.Seek(0, io.SeekEnd)
+		if err != nil {
+			return permanent(err)
+		}
+		if offset > 0 && (!settingsOf(ctx).resume || validator == "") {
+			if err := restart(); err != nil {
+				return permanent(err)
+			}
+			offset = 0
+		}
+		r := &resumeRange{Offset: offset, Validator: validator, Restart: restart}
+		n, err = fetch(ctx, u, f, size, progress, r)
+		validator = r.Validator
+		return err
+	})
+	return n, err
+}
+
+// resumeRange continues a download of which Offset bytes are already written.
+type resumeRange struct {
+	Offset int64
+	// Validator is the ETag or Last-Modified of the response the written bytes came
+	// from, sent as If-Range; fetch sets it from the response it reads.
+	Validator string
+	// Restart empties the destination when the whole file is sent instead.
+	Restart func() error
+}
+
+// download streams u into w and returns the number of bytes written. size is the
+// expected size used for the progress display when the response has no length.
+// progress receives the progress, nil renders the progress bar.
+func download(ctx context.Context, u string, w io.Writer, size int64, progress ProgressFunc) (int64, error) {
+	return fetch(ctx, u, w, size, progress, nil)
+}
+
+// fetch is download resuming at r.Offset when r is not nil. The returned count
+// includes the bytes written before.
+func fetch(ctx context.Context, u string, w io.Writer, size int64, progress ProgressFunc, r *resumeRange) (int64, error) {
+	settings := settingsOf(ctx)
+	maxArchiveMiB := settings.maxArchiveMiB
+	limit := int64(maxArchiveMiB) << 20
+	if limit > 0 && size > limit {
+		return 0, permanent(errors.Errorf("%s is %s according to the release list, more than -max-archive-size %d MiB", u, formatBytes(size), maxArchiveMiB))
+	}
+	ctx, done := traceRequest(ctx, u)
+	defer done()
+	var offset int64
+	if r != nil {
+		offset = r.Offset
+	}
+	for waits := 0; ; waits++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return 0, err
+		}
+		if offset > 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+			req.Header.Set("If-Range", r.Validator)
+		}
+		resp, err := settings.httpClient().Do(req)
+		if err != nil {
+			return offset, err
+		}
+		if resp.StatusCode == http.StatusTooManyRequests {
+			resp.Body.Close()
+			if err := waitRateLimited(ctx, u, resp.Header, waits); err != nil {
+				return offset, err
+			}
+			continue
+		}
+		switch {
+		case resp.StatusCode == http.StatusPartialContent && offset > 0:
+			if start, ok := contentRangeStart(resp.Header.Get("Content-Range")); !ok || start != offset {
+				resp.Body.Close()
+				if err := r.Restart(); err != nil {
+					return 0, permanent(err)
+				}
+				return 0, errors.Errorf("%s answered the range from byte %d with %q, starting over", u, offset, resp.Header.Get("Content-Range"))
+			}
+			fmt.Fprintf(settings.out, "resuming at %s of %s\n", formatBytes(offset), formatBytes(size))
+		case resp.StatusCode == http.StatusPartialContent:
+			// no Range header is sent, so a 206 is a proxy or CDN handing out part of
+			// the archive and must not be written as if it was all of it
+			resp.Body.Close()
+			return 0, permanent(errors.Errorf("%s returned 206 Partial Content (%s) to a request without a Range header",
+				u, resp.Header.Get("Content-Range")))
+		case resp.StatusCode == http.StatusOK && offset > 0:
+			// the server ignores ranges or the file changed since the first attempt
+			if err := r.Restart(); err != nil {
+				resp.Body.Close()
+				return 0, permanent(err)
+			}
+			settings.warnf("%s sent the whole file instead of the range from byte %d, downloading from the start", u, offset)
+			offset = 0
+		case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+			resp.Body.Close()
+			if err := r.Restart(); err != nil {
+				return 0, permanent(err)
+			}
+			return 0, errors.Errorf("%s cannot send the range from byte %d, starting over", u, offset)
+		case resp.StatusCode != http.StatusOK:
+			resp.Body.Close()
+			return offset, &statusError{URL: u, Code: resp.StatusCode}
+		}
+		if r != nil && offset == 0 {
+			r.Validator = resp.Header.Get("ETag")
+			if r.Validator == "" || strings.HasPrefix(r.Validator, "W/") {
+				// weak validators are not allowed in If-Range
+				r.Validator = resp.Header.Get("Last-Modified")
+			}
+		}
+		if final := resp.Request.URL.String(); final != u {
+			fmt.Fprintln(settings.out, "redirected to: ", final)
+		}
+		settings.logger().Debug("download", "url", u, "final", resp.Request.URL.String(), "offset", offset)
+		if limit > 0 && offset+resp.ContentLength > limit {
+			resp.Body.Close()
+			return offset, permanent(errors.Errorf("%s is %s, more than -max-archive-size %d MiB", u, formatBytes(offset+resp.ContentLength), maxArchiveMiB))
+		}
+		total := offset + resp.ContentLength
+		if resp.ContentLength <= 0 {
+			total = size
+		}
+		body := io.Reader(resp.Body)
+		if limit > 0 {
+			// the length may be unknown, or the server may send more than it said
+			body = io.LimitReader(resp.Body, limit+1-offset)
+		}
+		pw := newProgressWriter(w, total, progress)
+		pw.start(offset)
+		m, err := io.Copy(pw, body)
+		pw.finish()
+		resp.Body.Close()
+		n := offset + m
+		if err == nil && limit > 0 && n > limit {
+			return n, permanent(errors.Errorf("%s sent more than -max-archive-size %d MiB", u, maxArchiveMiB))
+		}
+		if err == nil && size > 0 && n != size {
+			err = errors.Errorf("%s sent %d bytes, the release list says %d", u, n, size)
+		}
+		return n, err
+	}
+}
+
+// contentRangeStart returns the first byte position of a Content-Range header
+// value such as "bytes 100-199/200".
+func contentRangeStart(v string) (int64, bool) {
+	v, ok := strings.CutPrefix(v, "bytes ")
+	if !ok {
+		return 0, false
+	}
+	start, _, ok := strings.Cut(v, "-")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(start), 10, 64)
+	return n, err == nil
+}
+
+// waitRateLimited sleeps for the Retry-After of a 429 response from u. It fails
+// instead when waits reached maxRateLimitWaits or when the wait would run past the
+// deadline of ctx.
+func waitRateLimited(ctx context.Context, u string, h http.Header, waits int) error {
+	if waits == maxRateLimitWaits {
+		return errors.Errorf("rate limited by %s, gave up after %d waits", u, waits)
+	}
+	wait := retryAfter(h.Get("Retry-After"), time.Now())
+	if deadline, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(deadline) {
+		return errors.Errorf("rate limited by %s, waiting %s would exceed the timeout", u, wait)
+	}
+	settingsOf(ctx).warnf("rate limited by %s, retrying in %s", u, wait)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(wait):
+		return nil
+	}
+}
+
+// retryAfter parses a Retry-After header value given either in seconds or as an
+// HTTP date.
+func retryAfter(v string, now time.Time) time.Duration {
+	v = strings.TrimSpace(v)
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d
+		}
+		return 0
+	}
+	return defaultRetryAfter
+}
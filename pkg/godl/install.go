@@ -0,0 +1,313 @@
+package godl
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/execabs"
+)
+
+// InstallOptions controls Install.
+type InstallOptions struct {
+	// GoRoot is the installation that is replaced.
+	GoRoot string
+	// StagingDir holds the extracted tree of the new version, on the filesystem of
+	// GoRoot so that it can be renamed into place.
+	StagingDir string
+	// PreviousVersion is the version in GoRoot, used to name the backup.
+	PreviousVersion string
+	// BackupTemplate and BackupRoot place the backup, see renderBackupPath.
+	BackupTemplate string
+	BackupRoot     string
+	// NoBackup removes the previous installation once the new one is in place and
+	// the hooks and Verify succeeded, instead of keeping it.
+	NoBackup bool
+	// Confirm is asked before anything changes; nil installs without asking.
+	Confirm func(question string) (bool, error)
+	// PreInstall and PostInstall are shell commands run before and after GoRoot is
+	// replaced, with the environment of hookEnviron.
+	PreInstall  string
+	PostInstall string
+	// HookFatal rolls back to the previous installation when PostInstall fails,
+	// otherwise the failure is only a warning.
+	HookFatal bool
+	// Fsync flushes the directories holding GoRoot and the backup to disk once
+	// the renames are done, so they survive a crash right after the install.
+	Fsync bool
+	// Verify checks the staged tree before anything changes, and the new
+	// installation again once it is in place, where an error rolls back.
+	Verify func(goRoot string) error
+}
+
+// InstallResult describes what Install moved where.
+type InstallResult struct {
+	// Version is the newly installed version.
+	Version string
+	// GoRoot is the installation that was replaced.
+	GoRoot string
+	// Backup is where the previous installation was kept, empty with NoBackup.
+	Backup string
+	// Installed reports whether the new version ended up in GoRoot.
+	Installed bool
+	// RolledBack reports whether the previous installation was put back after a
+	// failed check.
+	RolledBack bool
+}
+
+// Install replaces opts.GoRoot with the tree at opts.StagingDir, which holds file.
+// The swap is transactional: the staged tree is verified while GoRoot is still
+// untouched, the previous installation is renamed to the backup path, and
+// whatever fails after that puts it back, so GoRoot is never left missing or
+// holding a broken toolchain.
+func Install(ctx context.Context, file File, opts InstallOptions) (InstallResult, error) {
+	goRoot := opts.GoRoot
+	settings := settingsOf(ctx)
+	res := InstallResult{Version: fileVersion(file), GoRoot: goRoot}
+	now := time.Now()
+	backupPath, err := renderBackupPath(opts.BackupTemplate, opts.BackupRoot, goRoot, opts.PreviousVersion, now)
+	if err != nil {
+		return res, errors.Wrap(err, "backup path error")
+	}
+	if opts.BackupRoot != "" {
+		if err := os.MkdirAll(opts.BackupRoot, 0755); err != nil {
+			return res, errors.Wrap(err, "create backup root error")
+		}
+	}
+
+	if opts.Confirm != nil {
+		ok, err := opts.Confirm(fmt.Sprintf("About to replace GOROOT at %s (backing up to %s). Continue?", goRoot, backupPath))
+		if err != nil {
+			return res, err
+		}
+		if !ok {
+			return res, errors.New("aborted, GOROOT left untouched")
+		}
+	}
+
+	if opts.Verify != nil {
+		if err := opts.Verify(opts.StagingDir); err != nil {
+			return res, errors.Wrap(err, "the staged toolchain failed verification, GOROOT left untouched")
+		}
+	}
+
+	hookEnv := hookEnviron(res.Version, goRoot, backupPath)
+	if opts.PreInstall != "" {
+		if err := runHook(ctx, opts.PreInstall, hookEnv); err != nil {
+			return res, errors.Wrap(err, "pre-install hook failed, GOROOT left untouched")
+		}
+	}
+
+	if err := renameGoRoot(goRoot, backupPath); err != nil {
+		return res, errors.Errorf("rename error: %v %v %v", goRoot, backupPath, err)
+	}
+	// whatever happens from here on, GOROOT must not be left missing
+	defer func() {
+		if _, err := os.Lstat(goRoot); os.IsNotExist(err) {
+			if err := os.Rename(backupPath, goRoot); err != nil {
+				settings.warnf("restore %s from %s error: %s", goRoot, backupPath, err)
+			}
+		}
+	}()
+
+	if err := moveTree(opts.StagingDir, goRoot); err != nil {
+		if rerr := os.Rename(backupPath, goRoot); rerr != nil {
+			return res, errors.Errorf("move %s to %s error: %v, restore %s from %s error: %v", opts.StagingDir, goRoot, err, goRoot, backupPath, rerr)
+		}
+		return res, errors.Errorf("move %s to %s error: %v, restored the previous installation from %s", opts.StagingDir, goRoot, err, backupPath)
+	}
+	if err := markBackup(backupPath, now); err != nil {
+		settings.warnf("record the time of backup %s error: %s", backupPath, err)
+	}
+	// a restored backup brings its marker along
+	if err := os.Remove(filepath.Join(goRoot, backupMarker)); err != nil && !os.IsNotExist(err) {
+		settings.warnf("remove %s error: %s", filepath.Join(goRoot, backupMarker), err)
+	}
+	res.Installed, res.Backup = true, backupPath
+	if opts.Fsync {
+		for _, dir := range []string{filepath.Dir(goRoot), filepath.Dir(backupPath)} {
+			if err := syncDir(dir); err != nil {
+				return res, errors.Wrap(err, "fsync error")
+			}
+		}
+	}
+	settings.emit(streamEvent{Event: "install", Version: res.Version, GoRoot: goRoot, Backup: backupPath})
+
+	rollback := func(what string, err error) (InstallResult, error) {
+		if rerr := restoreBackup(goRoot, backupPath); rerr != nil {
+			return res, errors.Errorf("%s failed: %s, restore backup error: %s", what, err, rerr)
+		}
+		res.Installed, res.RolledBack, res.Backup = false, true, ""
+		return res, errors.Wrapf(err, "%s failed, restored %s from %s", what, goRoot, backupPath)
+	}
+	if opts.PostInstall != "" {
+		if err := runHook(ctx, opts.PostInstall, hookEnv); err != nil {
+			if opts.HookFatal {
+				return rollback("post-install hook", err)
+			}
+			settings.warnf("post-install hook failed: %s", err)
+		}
+	}
+	if opts.Verify != nil {
+		if err := opts.Verify(goRoot); err != nil {
+			return rollback("verification", err)
+		}
+	}
+	if opts.NoBackup {
+		if err := os.RemoveAll(backupPath); err != nil {
+			settings.warnf("remove previous installation %s error: %s", backupPath, err)
+		} else {
+			res.Backup = ""
+		}
+	}
+	return res, nil
+}
+
+// checkToolchain returns an InstallOptions.Verify that runs the go command of the
+// new installation itself, not whichever one PATH finds, and requires it to
+// report version. GOTOOLCHAIN=local keeps it from switching to another toolchain
+// named by a go.mod in the working directory.
+func checkToolchain(ctx context.Context, version string) func(goRoot string) error {
+	return func(goRoot string) error {
+		goBin := filepath.Join(goRoot, "bin", "go")
+		if runtime.GOOS == "windows" {
+			goBin += ".exe"
+		}
+		cmd := execabs.CommandContext(ctx, goBin, "version")
+		cmd.Env = append(os.Environ(), "GOROOT="+goRoot, "GOTOOLCHAIN=local")
+		out, err := cmd.Output()
+		if err != nil {
+			return errors.Wrapf(err, "run %s version", goBin)
+		}
+		iv, err := parseGoVersion(string(out))
+		if err != nil {
+			return err
+		}
+		if iv.Version != version {
+			return errors.Errorf("%s reports %s, want %s", goBin, iv.Version, version)
+		}
+		return nil
+	}
+}
+
+// renameGoRoot renames goRoot to backupPath. Windows refuses to rename a directory
+// while a program inside it runs or a scanner holds one of its files open, so
+// there the rename is retried for a few seconds before giving up with a hint.
+func renameGoRoot(goRoot, backupPath string) error {
+	err := os.Rename(goRoot, backupPath)
+	if err == nil || runtime.GOOS != "windows" {
+		return err
+	}
+	for i := 0; i < 10 && err != nil && !os.IsNotExist(err); i++ {
+		time.Sleep(500 * time.Millisecond)
+		err = os.Rename(goRoot, backupPath)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "%s is in use, close the programs running from it such as go.exe, gopls or an editor and try again", goRoot)
+	}
+	return err
+}
+
+// moveTree renames the directory src to dst. When they are on different filesystems,
+// where a rename fails, src is copied and removed instead; a failed copy leaves no
+// partial dst behind.
+func moveTree(src, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil || sameFilesystem(src, filepath.Dir(dst)) {
+		return err
+	}
+	if err := copyTree(src, dst); err != nil {
+		os.RemoveAll(dst)
+		return errors.Wrap(err, "copy across filesystems")
+	}
+	return os.RemoveAll(src)
+}
+
+// copyTree copies the directories, regular files and symlinks below src to dst,
+// keeping their permission bits.
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.Mkdir(target, info.Mode().Perm()|0700)
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case d.Type().IsRegular():
+			if err := copyFile(p, target); err != nil {
+				return err
+			}
+			return os.Chmod(target, info.Mode().Perm())
+		}
+		return errors.Errorf("%s: cannot copy %s", p, d.Type())
+	})
+}
+
+// rollbackGoRoot puts the most recently made backup of goRoot back in its place.
+// The backup is installed like a new release, so the current tree becomes a
+// backup in turn and the hooks, lock, confirmation and check of the go command
+// apply as usual.
+func rollbackGoRoot(ctx context.Context, goRoot string) error {
+	if !dryRun {
+		var unlock func()
+		var err error
+		if ctx, unlock, err = lockGoRoot(ctx, goRoot); err != nil {
+			return err
+		}
+		defer unlock()
+	}
+	backups, err := findBackups(goRoot, backupDir, backupRoot)
+	if err != nil {
+		return errors.Wrap(err, "list backups error")
+	}
+	if len(backups) == 0 {
+		return errors.Errorf("no backups of %s found", goRoot)
+	}
+	b := backups[0]
+	current, err := readVersionFile(goRoot)
+	if err != nil {
+		return errors.Wrap(err, "read the version of GOROOT")
+	}
+	if dryRun {
+		fmt.Fprintf(stdout, "would restore %s (%s) into %s, keeping %s as a backup\n", b.Path, b.Version, goRoot, current)
+		return nil
+	}
+	res, err := Install(ctx, File{Version: b.Version}, InstallOptions{
+		GoRoot:          goRoot,
+		StagingDir:      b.Path,
+		PreviousVersion: current,
+		BackupTemplate:  backupDir,
+		BackupRoot:      backupRoot,
+		Confirm:         confirm,
+		PreInstall:      preInstall,
+		PostInstall:     postInstall,
+		HookFatal:       hookFatal,
+		Fsync:           fsync,
+		Verify:          checkToolchain(ctx, b.Version),
+	})
+	if res.Installed {
+		metrics.InstalledVersion = res.Version
+		fmt.Fprintf(stdout, "restored %s, %s kept at %s\n", res.Version, current, res.Backup)
+	}
+	return err
+}
@@ -0,0 +1,263 @@
+package godl
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// treeEntry is what snapshotTree records of a file, directory or symlink.
+type treeEntry struct {
+	Mode fs.FileMode
+	Data string
+}
+
+// snapshotTree returns every entry below root by its slash separated path, with
+// its type and permission bits and the content of files or target of links.
+func snapshotTree(t *testing.T, root string) map[string]treeEntry {
+	t.Helper()
+	tree := map[string]treeEntry{}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, p)
+		e := treeEntry{Mode: info.Mode()}
+		switch {
+		case info.Mode()&fs.ModeSymlink != 0:
+			e.Data, err = os.Readlink(p)
+		case info.Mode().IsRegular():
+			var b []byte
+			b, err = os.ReadFile(p)
+			e.Data = string(b)
+		}
+		tree[filepath.ToSlash(rel)] = e
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+func TestRollbackRestoresPriorTree(t *testing.T) {
+	out := testSettings(t)
+	newFakeServer(t, "go1.20.14", "go1.21.5", "go1.22.1")
+	goRoot := setupGoRoot(t, "go1.20.14")
+
+	set(t, &wantVersion, "go1.21.5")
+	if err := safeRun(context.Background()); err != nil {
+		t.Fatalf("install go1.21.5: %v\n%s", err, out)
+	}
+	// an executable the archive does not have, with modes of its own
+	if err := os.WriteFile(filepath.Join(goRoot, "bin", "local-tool"), []byte("#!/bin/sh\n"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("bin/go", filepath.Join(goRoot, "go-link")); err != nil {
+		t.Fatal(err)
+	}
+	want := snapshotTree(t, goRoot)
+
+	wantVersion = "go1.22.1"
+	if err := safeRun(context.Background()); err != nil {
+		t.Fatalf("install go1.22.1: %v\n%s", err, out)
+	}
+	if v, _ := readVersionFile(goRoot); v != "go1.22.1" {
+		t.Fatalf("GOROOT has %s, want go1.22.1", v)
+	}
+
+	wantVersion = ""
+	set(t, &rollback, true)
+	if err := safeRun(context.Background()); err != nil {
+		t.Fatalf("rollback: %v\n%s", err, out)
+	}
+	got := snapshotTree(t, goRoot)
+	for name, e := range want {
+		if g, ok := got[name]; !ok {
+			t.Errorf("%s is missing after the rollback", name)
+		} else if !reflect.DeepEqual(g, e) {
+			t.Errorf("%s is %v %q after the rollback, want %v %q", name, g.Mode, g.Data, e.Mode, e.Data)
+		}
+	}
+	for name := range got {
+		if _, ok := want[name]; !ok {
+			t.Errorf("%s was added by the rollback", name)
+		}
+	}
+	// the replaced toolchain is a backup in turn
+	if v, err := readVersionFile(filepath.Join(filepath.Dir(goRoot), "go@go1.22.1")); err != nil || v != "go1.22.1" {
+		t.Errorf("backup go@go1.22.1 has %q, %v", v, err)
+	}
+}
+
+func TestRollbackPicksLatestBackup(t *testing.T) {
+	out := testSettings(t)
+	newFakeServer(t, "go1.20.14", "go1.21.5", "go1.22.1")
+	goRoot := setupGoRoot(t, "go1.20.14")
+	for _, v := range []string{"go1.21.5", "go1.22.1"} {
+		set(t, &wantVersion, v)
+		if err := safeRun(context.Background()); err != nil {
+			t.Fatalf("install %s: %v\n%s", v, err, out)
+		}
+	}
+	// the latest backup has the oldest modification time, as trees moved aside can
+	latest := filepath.Join(filepath.Dir(goRoot), "go@go1.21.5")
+	old := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(latest, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	wantVersion = ""
+	set(t, &rollback, true)
+	if err := safeRun(context.Background()); err != nil {
+		t.Fatalf("rollback: %v\n%s", err, out)
+	}
+	if v, _ := readVersionFile(goRoot); v != "go1.21.5" {
+		t.Fatalf("rolled back to %s, want go1.21.5", v)
+	}
+	if _, err := os.Lstat(filepath.Join(goRoot, backupMarker)); !os.IsNotExist(err) {
+		t.Errorf("the restored GOROOT has the backup marker: %v", err)
+	}
+
+	// a backup whose go command does not run as its version is not restored
+	latest = filepath.Join(filepath.Dir(goRoot), "go@go1.22.1")
+	if err := os.WriteFile(filepath.Join(latest, "bin", "go"), []byte("#!/bin/sh\nexit 1\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := safeRun(context.Background()); err == nil {
+		t.Fatal("restored a backup with a broken go command")
+	}
+	if v, _ := readVersionFile(goRoot); v != "go1.21.5" {
+		t.Errorf("GOROOT has %s after the refused rollback, want go1.21.5", v)
+	}
+}
+
+func TestInstallPanicKeepsGoRoot(t *testing.T) {
+	testSettings(t)
+	goRoot := setupGoRoot(t, "go1.21.5")
+	stagingRoot, err := os.MkdirTemp(filepath.Dir(goRoot), ".go.staging-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ExtractArchive(bytes.NewReader(fakeToolchain(t, "go1.22.1")), "go.tar.gz", stagingRoot, ExtractOptions{PreserveMode: true}); err != nil {
+		t.Fatal(err)
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Install did not panic")
+			}
+		}()
+		Install(context.Background(), File{Version: "go1.22.1"}, InstallOptions{
+			GoRoot:          goRoot,
+			StagingDir:      filepath.Join(stagingRoot, "go"),
+			PreviousVersion: "go1.21.5",
+			BackupTemplate:  defaultBackupTemplate,
+			// panic once the new tree is in place
+			Verify: func(dir string) error {
+				if dir == goRoot {
+					panic("verify")
+				}
+				return nil
+			},
+		})
+	}()
+	v, err := readVersionFile(goRoot)
+	if err != nil {
+		t.Fatalf("GOROOT is broken after the panic: %v", err)
+	}
+	if v == "go1.22.1" {
+		if b, err := readVersionFile(filepath.Join(filepath.Dir(goRoot), "go@go1.21.5")); err != nil || b != "go1.21.5" {
+			t.Errorf("the backup has %q, %v after the panic", b, err)
+		}
+	}
+}
+
+func TestInstallGoRootWithSpaces(t *testing.T) {
+	out := testSettings(t)
+	newFakeServer(t, "go1.21.5", "go1.22.1")
+	parent := filepath.Join(t.TempDir(), "Program Files", "Gö tools")
+	goRoot := setupGoRootIn(t, parent, "go1.21.5")
+	set(t, &staging, "sibling")
+
+	if err := safeRun(context.Background()); err != nil {
+		t.Fatalf("run: %v\n%s", err, out)
+	}
+	if v, err := readVersionFile(goRoot); err != nil || v != "go1.22.1" {
+		t.Fatalf("GOROOT has %q, %v, want go1.22.1\n%s", v, err, out)
+	}
+	if v, err := readVersionFile(filepath.Join(parent, "go@go1.21.5")); err != nil || v != "go1.21.5" {
+		t.Errorf("backup has %q, %v, want go1.21.5", v, err)
+	}
+	entries, _ := os.ReadDir(parent)
+	for _, e := range entries {
+		if strings.Contains(e.Name(), "staging") {
+			t.Errorf("staging directory %s was left behind", e.Name())
+		}
+	}
+}
+
+func TestRenderBackupPathWithSpaces(t *testing.T) {
+	now := time.Date(2024, 2, 3, 4, 5, 6, 0, time.UTC)
+	goRoot := filepath.Join(t.TempDir(), "Program Files", "Go")
+	for _, tt := range []struct {
+		tmpl, root, want string
+	}{
+		{"", "", filepath.Join(filepath.Dir(goRoot), "Go@go1.21.5")},
+		{"{name} backup {version}", "", filepath.Join(filepath.Dir(goRoot), "Go backup go1.21.5")},
+		{"Sicherung {version}", filepath.Join(filepath.Dir(goRoot), "Ablage für Go"), filepath.Join(filepath.Dir(goRoot), "Ablage für Go", "Sicherung go1.21.5")},
+	} {
+		got, err := renderBackupPath(tt.tmpl, tt.root, goRoot, "go1.21.5", now)
+		if err != nil || got != tt.want {
+			t.Errorf("renderBackupPath(%q, %q) = %q, %v, want %q", tt.tmpl, tt.root, got, err, tt.want)
+		}
+	}
+}
+
+func TestPruneBackupsNeedsPrefix(t *testing.T) {
+	set(t, &stdout, io.Writer(new(bytes.Buffer)))
+	dir := t.TempDir()
+	goRoot := filepath.Join(dir, "go")
+	// a backup of each template and a Go tree that is not a backup at all
+	trees := map[string]string{"go": "go1.22.1", "go@go1.21.5": "go1.21.5", "go1.20.1": "go1.20.1", "tinygo": "go1.19"}
+	for name, v := range trees {
+		if err := os.MkdirAll(filepath.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name, "VERSION"), []byte(v+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tmpl := range []string{"{version}", "{timestamp}-{name}", "{version}@{name}"} {
+		if err := pruneBackups(goRoot, tmpl, "", 0); err == nil {
+			t.Errorf("pruneBackups with template %q succeeded, want an error", tmpl)
+		}
+	}
+	for name := range trees {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s was removed: %v", name, err)
+		}
+	}
+
+	if err := pruneBackups(goRoot, "", "", 0); err != nil {
+		t.Fatal(err)
+	}
+	for name := range trees {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if removed := os.IsNotExist(err); removed != (name == "go@go1.21.5") {
+			t.Errorf("%s removed: %v, want only go@go1.21.5 removed", name, removed)
+		}
+	}
+}
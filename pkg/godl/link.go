@@ -0,0 +1,57 @@
+package godl
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/pkg/errors"
+)
+
+// linkTools points the go and, with gofmt, the gofmt symlinks in dir at the
+// binaries of root. Each link is replaced atomically through a temporary link and a
+// rename, and a link already pointing at the right binary is left alone. An
+// existing file that is not a symlink is never replaced.
+func linkTools(dir, root string, gofmt bool) error {
+	if runtime.GOOS == "windows" {
+		return errors.New("-link-dir is not supported on windows")
+	}
+	tools := []string{"go"}
+	if gofmt {
+		tools = append(tools, "gofmt")
+	}
+	for _, tool := range tools {
+		if err := replaceSymlink(filepath.Join(dir, tool), filepath.Join(root, "bin", tool)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceSymlink makes link a symlink to target.
+func replaceSymlink(link, target string) error {
+	fi, err := os.Lstat(link)
+	switch {
+	case err == nil && fi.Mode()&os.ModeSymlink == 0:
+		warnf("%s exists and is not a symlink, leaving it alone", link)
+		return nil
+	case err == nil:
+		if cur, err := os.Readlink(link); err == nil && cur == target {
+			return nil
+		}
+	case !os.IsNotExist(err):
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(link), "."+filepath.Base(link)+".godl-tmp")
+	os.Remove(tmp)
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, link); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	fmt.Fprintf(stdout, "linked: %s -> %s\n", link, target)
+	return nil
+}
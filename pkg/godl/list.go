@@ -0,0 +1,121 @@
+package godl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// listEntry is a line of the -list output.
+type listEntry struct {
+	Version   string `json:"version"`
+	Filename  string `json:"filename"`
+	Kind      string `json:"kind"`
+	Size      int64  `json:"size"`
+	Stable    bool   `json:"stable"`
+	Installed bool   `json:"installed"`
+	Newer     bool   `json:"newer"`
+}
+
+// listReleases prints the releases published for the platform of iv, newest first,
+// marking the installed one. Only the releases of -channel are listed, and with
+// since only the versions strictly newer than it.
+func listReleases(ctx context.Context, src Source, iv InstalledVersion, since string) error {
+	if since != "" && !strings.HasPrefix(since, "go") {
+		since = "go" + since
+	}
+	rs, err := Releases(ctx, ReleaseOptions{Source: src, All: allReleases || since != "", Channel: releaseChannel, OS: iv.Os, Arch: iv.Arch})
+	if err != nil {
+		return err
+	}
+	var entries []listEntry
+	for _, r := range rs {
+		if since != "" && CompareVersions(r.Version, since) <= 0 {
+			continue
+		}
+		for _, f := range r.Files {
+			if kind != "" && f.Kind != kind {
+				continue
+			}
+			entries = append(entries, listEntry{
+				Version:   r.Version,
+				Filename:  f.Filename,
+				Kind:      f.Kind,
+				Size:      int64(f.Size),
+				Stable:    r.Stable,
+				Installed: r.Version == iv.Version,
+				Newer:     iv.Version != "" && CompareVersions(r.Version, iv.Version) > 0,
+			})
+		}
+	}
+	if jsonOutput {
+		if entries == nil {
+			entries = []listEntry{}
+		}
+		return json.NewEncoder(os.Stdout).Encode(entries)
+	}
+	for _, e := range entries {
+		mark := " "
+		switch {
+		case e.Installed:
+			mark = "*"
+		case e.Newer:
+			mark = "+"
+		}
+		fmt.Fprintf(stdout, "%s %-14s %-9s %10s %s\n", mark, e.Version, e.Kind, formatBytes(e.Size), e.Filename)
+	}
+	return nil
+}
+
+// platformEntry is a line of the -platforms output.
+type platformEntry struct {
+	OS       string `json:"os"`
+	Arch     string `json:"arch"`
+	Kind     string `json:"kind"`
+	Filename string `json:"filename"`
+	Host     bool   `json:"host"`
+}
+
+// listPlatforms prints the files published for version, one per OS, architecture
+// and kind, marking the ones for the platform of iv.
+func listPlatforms(ctx context.Context, src Source, iv InstalledVersion, version string) error {
+	rs, err := Releases(ctx, ReleaseOptions{Source: src, All: true, Channel: "all"})
+	if err != nil {
+		return err
+	}
+	v, err := resolveVersion(rs, version)
+	if err != nil {
+		return err
+	}
+	var entries []platformEntry
+	for _, r := range rs {
+		if r.Version != v {
+			continue
+		}
+		for _, p := range SupportedPlatforms([]Release{r}) {
+			for _, f := range r.Files {
+				if f.Os == p.OS && f.Arch == p.Arch {
+					entries = append(entries, platformEntry{OS: f.Os, Arch: f.Arch, Kind: f.Kind, Filename: f.Filename, Host: f.Os == iv.Os && f.Arch == iv.Arch})
+				}
+			}
+		}
+		break
+	}
+	if jsonOutput {
+		if entries == nil {
+			entries = []platformEntry{}
+		}
+		return json.NewEncoder(os.Stdout).Encode(entries)
+	}
+	fmt.Fprintf(stdout, "%s:\n", v)
+	for _, e := range entries {
+		mark := " "
+		if e.Host {
+			mark = "*"
+		}
+		fmt.Fprintf(stdout, "%s %-10s %-9s %-9s %s\n", mark, e.OS, e.Arch, e.Kind, e.Filename)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package godl
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// lockPollInterval is how often a held lock is retried while waiting for it.
+const lockPollInterval = 250 * time.Millisecond
+
+// errLocked is returned by tryLock when another process holds the lock.
+var errLocked = errors.New("locked")
+
+// lockPath returns the lockfile guarding goRoot. It lives next to GOROOT because
+// GOROOT itself is renamed while the lock is held.
+func lockPath(goRoot string) string {
+	return filepath.Join(filepath.Dir(goRoot), "."+filepath.Base(goRoot)+".godl.lock")
+}
+
+// acquireLock takes the exclusive lock at path, waiting up to timeout for another
+// instance to release it. The returned function releases the lock.
+func acquireLock(ctx context.Context, path string, timeout time.Duration) (func(), error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		err := tryLock(f)
+		if err == nil {
+			return func() { f.Close() }, nil
+		}
+		if !errors.Is(err, errLocked) {
+			f.Close()
+			return nil, err
+		}
+		if !time.Now().Before(deadline) {
+			f.Close()
+			return nil, errors.Errorf("another godl is installing into the same GOROOT, it holds %s", path)
+		}
+		select {
+		case <-ctx.Done():
+			f.Close()
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// lockWait returns the -lock-timeout duration.
+func lockWait() (time.Duration, error) {
+	if lockTimeout == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(lockTimeout)
+	return d, errors.Wrap(err, "invalid -lock-timeout")
+}
+
+type lockKey struct{}
+
+// lockGoRoot takes the lock of goRoot, waiting up to -lock-timeout, and returns ctx
+// recording that it is held, so that a later lockGoRoot of the run for the same
+// GOROOT returns right away instead of waiting for itself.
+func lockGoRoot(ctx context.Context, goRoot string) (context.Context, func(), error) {
+	p := lockPath(goRoot)
+	if held, _ := ctx.Value(lockKey{}).(string); held == p {
+		return ctx, func() {}, nil
+	}
+	wait, err := lockWait()
+	if err != nil {
+		return ctx, nil, err
+	}
+	unlock, err := acquireLock(ctx, p, wait)
+	if err != nil {
+		return ctx, nil, errors.Wrap(err, "lock error")
+	}
+	return context.WithValue(ctx, lockKey{}, p), unlock, nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd && !openbsd && !netbsd && !dragonfly && !windows
+
+package godl
+
+import "os"
+
+// tryLock does not lock on this platform, concurrent runs are not detected.
+func tryLock(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,119 @@
+package godl
+
+import (
+	"context"
+	"log/slog"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// fileLog receives the run's events, warnings and errors as JSON records when
+// -log-file is set, nil otherwise.
+var fileLog *slog.Logger
+
+// logger is the logger of the run, configured by setupLogging. Nothing logs
+// through the slog default logger, whose format is not under our control.
+var logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+// validateLogFormat checks -log-format.
+func validateLogFormat() error {
+	switch logFormat {
+	case "", "text", "json":
+		return nil
+	}
+	return errors.Errorf("invalid -log-format value %q, want text or json", logFormat)
+}
+
+// logLevel returns the level of the records printed on stderr: warnings and errors
+// by default, the steps of the run with -v, everything with -vv and only errors
+// with -quiet.
+func logLevel() slog.Level {
+	switch {
+	case quiet:
+		return slog.LevelError
+	case veryVerbose:
+		return slog.LevelDebug
+	case verbose:
+		return slog.LevelInfo
+	}
+	return slog.LevelWarn
+}
+
+// jsonLogs reports whether the records on stderr are JSON: with -log-format json,
+// and with -json and -json-stream so that everything godl prints is machine
+// readable.
+func jsonLogs() bool {
+	return logFormat == "json" || jsonOutput || jsonStream
+}
+
+// setupLogging configures logger: text or JSON records on stderr at logLevel, and
+// with -log-file every record is also written to fileLog.
+func setupLogging() {
+	opts := &slog.HandlerOptions{Level: logLevel()}
+	var h slog.Handler = slog.NewTextHandler(os.Stderr, opts)
+	if jsonLogs() {
+		h = slog.NewJSONHandler(os.Stderr, opts)
+	}
+	if fileLog != nil {
+		h = teeHandler{h, fileLog.Handler()}
+	}
+	logger = slog.New(h)
+}
+
+// openLogFile opens the log file at path for appending. A file that already grew
+// past maxSize bytes is first moved to path.1, replacing the previous one, so at
+// most two files are kept; 0 disables rotation.
+func openLogFile(path string, maxSize int64) (*os.File, error) {
+	if info, err := os.Stat(path); err == nil && maxSize > 0 && info.Size() >= maxSize {
+		if err := os.Rename(path, path+".1"); err != nil {
+			return nil, err
+		}
+	}
+	return os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+}
+
+// teeHandler passes every record to both of its handlers.
+type teeHandler struct {
+	a, b slog.Handler
+}
+
+func (h teeHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	return h.a.Enabled(ctx, l) || h.b.Enabled(ctx, l)
+}
+
+func (h teeHandler) Handle(ctx context.Context, r slog.Record) error {
+	var err error
+	if h.a.Enabled(ctx, r.Level) {
+		err = h.a.Handle(ctx, r.Clone())
+	}
+	if h.b.Enabled(ctx, r.Level) {
+		if berr := h.b.Handle(ctx, r); berr != nil {
+			err = berr
+		}
+	}
+	return err
+}
+
+func (h teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return teeHandler{h.a.WithAttrs(attrs), h.b.WithAttrs(attrs)}
+}
+
+func (h teeHandler) WithGroup(name string) slog.Handler {
+	return teeHandler{h.a.WithGroup(name), h.b.WithGroup(name)}
+}
+
+// setupLogFile opens the -log-file as fileLog. The returned function flushes and
+// closes the file.
+func setupLogFile(path string, maxSize int64) (func(), error) {
+	f, err := openLogFile(path, maxSize)
+	if err != nil {
+		return nil, err
+	}
+	fileLog = slog.New(slog.NewJSONHandler(f, nil))
+	fileLog.Info("start", "args", os.Args[1:], "pid", os.Getpid())
+	return func() {
+		f.Sync()
+		f.Close()
+	}, nil
+}
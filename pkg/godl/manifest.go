@@ -0,0 +1,135 @@
+package godl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// manifest records the sha256 of every regular file of a GOROOT as installed, so
+// that verify can check it later without the release archive.
+type manifest struct {
+	Version string            `json:"version"`
+	Created time.Time         `json:"created"`
+	Files   map[string]string `json:"files"`
+}
+
+// manifestPath returns where the manifest of goRoot is kept: beside it rather than
+// inside, where it would be one of the files it lists.
+func manifestPath(goRoot string) string {
+	return filepath.Join(filepath.Dir(goRoot), "."+filepath.Base(goRoot)+".godl-manifest.json")
+}
+
+// writeManifest hashes the files of goRoot, which holds version, and records them
+// in its manifest.
+func writeManifest(goRoot, version string, now time.Time) error {
+	files, err := treeFiles(goRoot)
+	if err != nil {
+		return err
+	}
+	m := manifest{Version: version, Created: now.UTC(), Files: make(map[string]string, len(files))}
+	for rel := range files {
+		sum, err := hashFile(filepath.Join(goRoot, filepath.FromSlash(rel)))
+		if err != nil {
+			return err
+		}
+		m.Files[rel] = sum
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(manifestPath(goRoot), strings.NewReader(string(b)), 0644, fsync)
+}
+
+// recordManifest writes the manifest of the freshly installed goRoot; failing to is
+// only a warning, verify falls back to the release archive.
+func recordManifest(goRoot, version string) {
+	if err := writeManifest(goRoot, version, time.Now()); err != nil {
+		warnf("record the manifest of %s error: %s", goRoot, err)
+	}
+}
+
+// readManifest reads the manifest of goRoot.
+func readManifest(goRoot string) (manifest, error) {
+	var m manifest
+	b, err := os.ReadFile(manifestPath(goRoot))
+	if err != nil {
+		return m, err
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return m, errors.Wrapf(err, "parse %s", manifestPath(goRoot))
+	}
+	return m, nil
+}
+
+// checkManifest compares the files of goRoot with m.
+func checkManifest(m manifest, goRoot string) (auditReport, error) {
+	report := auditReport{Version: m.Version, GoRoot: goRoot}
+	local, err := treeFiles(goRoot)
+	if err != nil {
+		return report, err
+	}
+	for rel, want := range m.Files {
+		report.Checked++
+		if _, ok := local[rel]; !ok {
+			report.Missing = append(report.Missing, rel)
+			continue
+		}
+		sum, err := hashFile(filepath.Join(goRoot, filepath.FromSlash(rel)))
+		if err != nil {
+			return report, err
+		}
+		if sum != want {
+			report.Modified = append(report.Modified, rel)
+		}
+	}
+	for rel := range local {
+		if _, ok := m.Files[rel]; !ok {
+			report.Added = append(report.Added, rel)
+		}
+	}
+	sort.Strings(report.Added)
+	sort.Strings(report.Missing)
+	sort.Strings(report.Modified)
+	return report, nil
+}
+
+// verifyGoRoot checks the integrity of goRoot against the manifest recorded when
+// godl installed it, or, without one for the version in goRoot, against the
+// official archive like -audit, and fails on any modified, missing or extra file.
+func verifyGoRoot(ctx context.Context, src Source, iv InstalledVersion, goRoot string) error {
+	v, err := readVersionFile(goRoot)
+	if err != nil {
+		return errors.Wrapf(err, "read the version of %s", goRoot)
+	}
+	m, err := readManifest(goRoot)
+	switch {
+	case os.IsNotExist(err):
+		fmt.Fprintf(stdout, "no manifest recorded for %s, checking against the official archive\n", goRoot)
+		return auditGoRoot(ctx, src, iv, goRoot)
+	case err != nil:
+		return err
+	case m.Version != v:
+		fmt.Fprintf(stdout, "the manifest of %s is for %s, not %s, checking against the official archive\n", goRoot, m.Version, v)
+		return auditGoRoot(ctx, src, iv, goRoot)
+	}
+	report, err := checkManifest(m, goRoot)
+	if err != nil {
+		return err
+	}
+	if err := printAudit(report, "the manifest recorded "+m.Created.Format(time.RFC3339)); err != nil {
+		return err
+	}
+	if report.drifted() {
+		return errors.Errorf("%s differs from the manifest recorded when %s was installed", goRoot, m.Version)
+	}
+	return nil
+}
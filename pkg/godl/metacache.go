@@ -0,0 +1,126 @@
+package godl
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// cachedList is a release list response kept in the -metadata-cache directory,
+// with the validators to revalidate it by.
+type cachedList struct {
+	URL          string          `json:"url"`
+	ETag         string          `json:"etag,omitempty"`
+	LastModified string          `json:"last_modified,omitempty"`
+	Fetched      time.Time       `json:"fetched"`
+	Body         json.RawMessage `json:"body"`
+}
+
+// defaultMetaCacheDir returns the godl directory of the user cache, empty when
+// the platform has none.
+func defaultMetaCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "godl")
+}
+
+// metaCachePath returns the cache file of the release list at u.
+func metaCachePath(dir, u string) string {
+	sum := sha256.Sum256([]byte(u))
+	return filepath.Join(dir, "releases-"+hex.EncodeToString(sum[:8])+".json")
+}
+
+// loadCachedList returns the cached response for u, if any.
+func loadCachedList(dir, u string) (cachedList, bool) {
+	b, err := os.ReadFile(metaCachePath(dir, u))
+	if err != nil {
+		return cachedList{}, false
+	}
+	var c cachedList
+	if err := json.Unmarshal(b, &c); err != nil || c.URL != u || len(c.Body) == 0 {
+		return cachedList{}, false
+	}
+	return c, true
+}
+
+// storeCachedList saves c in the cache of s; failures only cost the next run a
+// full request.
+func storeCachedList(s transferSettings, c cachedList) {
+	dir := s.metaCacheDir
+	b, err := json.Marshal(c)
+	if err == nil {
+		err = os.MkdirAll(dir, 0755)
+	}
+	if err == nil {
+		err = replaceFile(metaCachePath(dir, c.URL), b)
+	}
+	if err != nil {
+		s.warnf("cache release list error: %s", err)
+	}
+}
+
+// fetchCachedList returns the release list at u through the
+// -metadata-cache: a copy younger than -metadata-ttl is used as is, an older one is
+// revalidated with If-None-Match and If-Modified-Since, and when the request fails
+// the stale copy is used with a warning. With -offline only the cache is read.
+func fetchCachedList(ctx context.Context, u string) ([]Release, error) {
+	s := settingsOf(ctx)
+	cached, ok := loadCachedList(s.metaCacheDir, u)
+	switch {
+	case s.offline && !ok:
+		return nil, errors.Errorf("-offline is set and %s holds no copy of %s", s.metaCacheDir, u)
+	case s.offline:
+		s.logger().Debug("release list from cache", "url", u, "fetched", cached.Fetched)
+		return decodeReleaseList(u, cached.Body)
+	case ok && time.Since(cached.Fetched) < s.metaCacheTTL:
+		s.logger().Debug("release list from cache", "url", u, "fetched", cached.Fetched)
+		return decodeReleaseList(u, cached.Body)
+	}
+	h := map[string]string{}
+	if ok && cached.ETag != "" {
+		h["If-None-Match"] = cached.ETag
+	}
+	if ok && cached.LastModified != "" {
+		h["If-Modified-Since"] = cached.LastModified
+	}
+	start := time.Now()
+	c, err := httpGetHeaders(ctx, u, h)
+	if err == nil && ok && c.StatusCode() == http.StatusNotModified {
+		cached.Fetched = time.Now()
+		storeCachedList(s, cached)
+		return decodeReleaseList(u, cached.Body)
+	}
+	if err == nil {
+		err = checkJSONResponse(u, c.StatusCode(), c.Headers().Get("Content-Type"), c.Body())
+	}
+	if err != nil {
+		if ok && ctx.Err() == nil {
+			s.warnf("%s, using the release list cached %s", err, daysAgo(cached.Fetched, time.Now()))
+			return decodeReleaseList(u, cached.Body)
+		}
+		return nil, err
+	}
+	// only a list that passes validation is kept
+	rs, err := decodeReleaseList(u, c.Body())
+	if err != nil {
+		return nil, err
+	}
+	storeCachedList(s, cachedList{
+		URL:          u,
+		ETag:         c.Headers().Get("ETag"),
+		LastModified: c.Headers().Get("Last-Modified"),
+		Fetched:      time.Now(),
+		Body:         c.Body(),
+	})
+	s.logger().Info("release list", "url", u, "releases", len(rs), "bytes", len(c.Body()), "duration", time.Since(start))
+	return rs, nil
+}
@@ -0,0 +1,65 @@
+package godl
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// runMetrics collects what a run found and did for -metrics-file.
+type runMetrics struct {
+	InstalledVersion string
+	UpgradeAvailable bool
+	DownloadBytes    int64
+}
+
+var metrics runMetrics
+
+// writeMetrics writes m in the node_exporter textfile collector format. The file is
+// written next to path and renamed into place so the collector never reads a
+// partial file.
+func writeMetrics(path string, m runMetrics, now time.Time, runErr error) error {
+	var b bytes.Buffer
+	gauge := func(name, help, labels string, v string) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n%s%s %s\n", name, help, name, name, labels, v)
+	}
+	if m.InstalledVersion != "" {
+		gauge("godl_installed_version_info", "Go version installed in GOROOT.", fmt.Sprintf("{version=%q}", m.InstalledVersion), "1")
+	}
+	gauge("godl_last_run_timestamp", "Unix time of the last godl run.", "", strconv.FormatInt(now.Unix(), 10))
+	gauge("godl_last_run_success", "Whether the last godl run succeeded.", "", boolMetric(!runFailed(runErr)))
+	gauge("godl_upgrade_available", "Whether a newer Go release than the installed one is available.", "", boolMetric(m.UpgradeAvailable))
+	gauge("godl_last_download_bytes", "Bytes downloaded by the last godl run.", "", strconv.FormatInt(m.DownloadBytes, 10))
+	return replaceFile(path, b.Bytes())
+}
+
+// replaceFile writes data to a temporary file next to path and renames it into
+// place, so readers see either the old or the new content.
+func replaceFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-"+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func boolMetric(v bool) string {
+	if v {
+		return "1"
+	}
+	return "0"
+}
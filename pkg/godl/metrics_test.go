@@ -0,0 +1,36 @@
+package godl
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestWriteMetricsSuccess(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "godl.prom")
+	m := runMetrics{InstalledVersion: "go1.21.5", UpgradeAvailable: true}
+	for _, tt := range []struct {
+		err  error
+		want string
+	}{
+		{nil, "godl_last_run_success 1\n"},
+		// check found an update, the run itself succeeded
+		{errors.Wrap(ErrUpdateAvailable, "go1.21.5 → go1.22.1"), "godl_last_run_success 1\n"},
+		{errors.New("download failed"), "godl_last_run_success 0\n"},
+	} {
+		if err := writeMetrics(path, m, time.Unix(1700000000, 0), tt.err); err != nil {
+			t.Fatal(err)
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(b), tt.want) || !strings.Contains(string(b), "godl_upgrade_available 1\n") {
+			t.Errorf("metrics of a run ending with %v:\n%s\nwant %q", tt.err, b, tt.want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package godl
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// netrcLogin is the credentials of a machine entry of a netrc file.
+type netrcLogin struct {
+	login, password string
+}
+
+// netrcPath returns the netrc file to read: $NETRC, or .netrc (_netrc on Windows)
+// in the home directory.
+func netrcPath() string {
+	if p := os.Getenv("NETRC"); p != "" {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	if runtime.GOOS == "windows" {
+		return filepath.Join(home, "_netrc")
+	}
+	return filepath.Join(home, ".netrc")
+}
+
+// parseNetrc returns the logins of the machine entries of a netrc file keyed by
+// host. The default entry is ignored so that credentials are only ever sent to
+// hosts named explicitly, and macdef bodies are skipped.
+func parseNetrc(data string) map[string]netrcLogin {
+	logins := make(map[string]netrcLogin)
+	var (
+		machine string
+		cur     netrcLogin
+	)
+	flush := func() {
+		if machine != "" && cur.login != "" {
+			logins[machine] = cur
+		}
+		machine, cur = "", netrcLogin{}
+	}
+	lines := strings.Split(data, "\n")
+	for i := 0; i < len(lines); i++ {
+		fields := strings.Fields(lines[i])
+		for j := 0; j < len(fields); j++ {
+			next := func() string {
+				if j+1 < len(fields) {
+					j++
+					return fields[j]
+				}
+				return ""
+			}
+			switch fields[j] {
+			case "machine":
+				flush()
+				machine = next()
+			case "default":
+				flush()
+			case "login":
+				cur.login = next()
+			case "password":
+				cur.password = next()
+			case "account":
+				next()
+			case "macdef":
+				flush()
+				// the macro runs until the next empty line
+				for i++; i < len(lines) && strings.TrimSpace(lines[i]) != ""; i++ {
+				}
+				j = len(fields)
+			}
+		}
+	}
+	flush()
+	return logins
+}
+
+// netrcTransport adds the basic auth credentials of the netrc entry of the host of
+// each HTTPS request that carries none yet.
+type netrcTransport struct {
+	next   http.RoundTripper
+	logins map[string]netrcLogin
+}
+
+func (t netrcTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if l, ok := t.logins[req.URL.Hostname()]; ok && req.URL.Scheme == "https" && req.Header.Get("Authorization") == "" {
+		req = req.Clone(req.Context())
+		req.SetBasicAuth(l.login, l.password)
+	}
+	return t.next.RoundTrip(req)
+}
+
+func (t netrcTransport) unwrap() http.RoundTripper {
+	return t.next
+}
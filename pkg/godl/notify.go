@@ -0,0 +1,90 @@
+package godl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// updateNotice is the generic -webhook payload of check.
+type updateNotice struct {
+	Event     string `json:"event"`
+	Host      string `json:"host,omitempty"`
+	Installed string `json:"installed"`
+	Available string `json:"available"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+	URL       string `json:"url,omitempty"`
+}
+
+// text is the one line summary of n posted to chat webhooks.
+func (n updateNotice) text() string {
+	host := n.Host
+	if host == "" {
+		host = "this host"
+	}
+	return fmt.Sprintf("Go %s is available on %s, which has %s (%s/%s)", n.Available, host, n.Installed, n.OS, n.Arch)
+}
+
+// notifyWebhook posts n to u in the shape format names: generic posts n as is,
+// slack and teams post its text as a message.
+func notifyWebhook(ctx context.Context, u, format string, n updateNotice) error {
+	var payload any = n
+	switch format {
+	case "", "generic":
+	case "slack", "teams":
+		payload = map[string]string{"text": n.text()}
+	default:
+		return errors.Errorf("invalid -webhook-format %q, want generic, slack or teams", format)
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return &statusError{URL: redactURL(u), Code: resp.StatusCode}
+	}
+	return nil
+}
+
+// reportUpdate prints that file is newer than the installed iv, posts it to the
+// -webhook and returns ErrUpdateAvailable for the exit status of check.
+func reportUpdate(ctx context.Context, src Source, iv InstalledVersion, file File) error {
+	n := updateNotice{
+		Event:     "update-available",
+		Installed: iv.Version,
+		Available: fileVersion(file),
+		OS:        iv.Os,
+		Arch:      iv.Arch,
+		URL:       src.fileURL(file.Filename),
+	}
+	n.Host, _ = os.Hostname()
+	if pinnedBy != "" {
+		n.Event = "toolchain-drift"
+		fmt.Fprintf(stdout, "toolchain drift: %s pins %s, the installed toolchain is %s\n", pinnedBy, n.Available, n.Installed)
+	} else {
+		fmt.Fprintf(stdout, "update available: %s → %s\n", n.Installed, n.Available)
+	}
+	result.done("update-available", "")
+	if webhookURL != "" {
+		if err := notifyWebhook(ctx, webhookURL, webhookFormat, n); err != nil {
+			warnf("notify webhook error: %s", err)
+		}
+	}
+	return errors.Wrapf(ErrUpdateAvailable, "%s → %s", n.Installed, n.Available)
+}
@@ -0,0 +1,78 @@
+package godl
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// stdout receives the human readable output. With -json-stream it is stderr, so
+// that stdout carries nothing but events.
+var stdout io.Writer = os.Stdout
+
+// streamEvent is a single line of -json-stream output.
+type streamEvent struct {
+	Event   string `json:"event"`
+	Version string `json:"version,omitempty"`
+	File    string `json:"file,omitempty"`
+	Bytes   int64  `json:"bytes,omitempty"`
+	Total   int64  `json:"total,omitempty"`
+	OK      *bool  `json:"ok,omitempty"`
+	GoRoot  string `json:"goroot,omitempty"`
+	Backup  string `json:"backup,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+var (
+	eventEncoder = json.NewEncoder(os.Stdout)
+	// eventMu serializes the events of parallel downloads
+	eventMu sync.Mutex
+)
+
+// emit writes e to stdout when -json-stream is set, to the -log-file and to the
+// -summary-json, and logs it as a step of the run. Only the final download event
+// of a transfer is logged, not every progress update. The error that ends the run
+// is printed by Main, so only the -log-file records it.
+func emit(e streamEvent) {
+	recordEvent(e)
+	if jsonStream {
+		eventMu.Lock()
+		_ = eventEncoder.Encode(e)
+		eventMu.Unlock()
+	}
+	switch {
+	case e.Event == "error":
+		if fileLog != nil {
+			fileLog.Error(e.Error, "event", e)
+		}
+	case e.Event != "download" || e.Bytes == e.Total:
+		logger.Info(e.Event, "event", e)
+	}
+}
+
+// LogValue logs the set fields of e as a group named like its JSON keys.
+func (e streamEvent) LogValue() slog.Value {
+	attrs := []slog.Attr{slog.String("event", e.Event)}
+	add := func(key, v string) {
+		if v != "" {
+			attrs = append(attrs, slog.String(key, v))
+		}
+	}
+	add("version", e.Version)
+	add("file", e.File)
+	if e.Bytes != 0 {
+		attrs = append(attrs, slog.Int64("bytes", e.Bytes))
+	}
+	if e.Total != 0 {
+		attrs = append(attrs, slog.Int64("total", e.Total))
+	}
+	if e.OK != nil {
+		attrs = append(attrs, slog.Bool("ok", *e.OK))
+	}
+	add("goroot", e.GoRoot)
+	add("backup", e.Backup)
+	add("error", e.Error)
+	return slog.GroupValue(attrs...)
+}
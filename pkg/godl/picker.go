@@ -0,0 +1,187 @@
+package godl
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// pickerRows is the number of releases the picker shows at once.
+const pickerRows = 12
+
+// errPickAborted is returned when the picker is left without choosing a version.
+var errPickAborted = errors.New("no version picked, GOROOT left untouched")
+
+// pickerEntry is a release offered by the picker.
+type pickerEntry struct {
+	Version   string
+	Size      int64
+	Stable    bool
+	Installed bool
+	Backup    bool
+	Cached    bool
+}
+
+// canPick reports whether the interactive picker can be shown: stdin and stderr
+// are terminals and -yes does not ask for an unattended run.
+func canPick() bool {
+	return !assumeYes && isTerminal(os.Stdin.Fd()) && isTerminal(os.Stderr.Fd())
+}
+
+// pickerEntries returns the releases for the platform of iv, newest first, with
+// the active one, the ones kept as backups of goRoot and the cached ones marked.
+func pickerEntries(ctx context.Context, src Source, iv InstalledVersion, goRoot string) ([]pickerEntry, error) {
+	rs, err := Releases(ctx, ReleaseOptions{Source: src, All: allReleases, Channel: "all", OS: iv.Os, Arch: iv.Arch})
+	if err != nil {
+		return nil, err
+	}
+	backedUp := map[string]bool{}
+	if backups, err := findBackups(goRoot, backupDir, backupRoot); err == nil {
+		for _, b := range backups {
+			backedUp[b.Version] = true
+		}
+	}
+	var entries []pickerEntry
+	for _, r := range rs {
+		for _, f := range r.Files {
+			if f.Kind != kind {
+				continue
+			}
+			e := pickerEntry{Version: r.Version, Size: int64(f.Size), Stable: r.Stable, Installed: r.Version == iv.Version, Backup: backedUp[r.Version]}
+			if cacheDir != "" {
+				_, e.Cached = cachedArchive(cacheDir, f)
+			}
+			entries = append(entries, e)
+			break
+		}
+	}
+	if len(entries) == 0 {
+		return nil, errors.Errorf("no releases for %s/%s to pick from", iv.Os, iv.Arch)
+	}
+	return entries, nil
+}
+
+// pickVersion lets the user choose one of entries with the arrow keys, or j and
+// k, and enter; q, escape and Ctrl-C return errPickAborted. The list is drawn on
+// stderr while stdin is in raw mode.
+func pickVersion(entries []pickerEntry) (string, error) {
+	restore, err := makeRaw(os.Stdin.Fd())
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+	in := bufio.NewReader(os.Stdin)
+	cursor, top, drawn := 0, 0, 0
+	for i, e := range entries {
+		if e.Installed {
+			// start on the active toolchain
+			cursor = i
+			break
+		}
+	}
+	for {
+		if cursor < top {
+			top = cursor
+		}
+		if cursor >= top+pickerRows {
+			top = cursor - pickerRows + 1
+		}
+		drawn = drawPicker(os.Stderr, entries, cursor, top, drawn)
+		key, err := readKey(in)
+		if err != nil {
+			return "", err
+		}
+		switch key {
+		case "up", "k":
+			if cursor > 0 {
+				cursor--
+			}
+		case "down", "j":
+			if cursor < len(entries)-1 {
+				cursor++
+			}
+		case "enter":
+			fmt.Fprintln(os.Stderr)
+			return entries[cursor].Version, nil
+		case "quit":
+			fmt.Fprintln(os.Stderr)
+			return "", errPickAborted
+		}
+	}
+}
+
+// readKey reads a key press from r and names it: up, down, enter, quit, or the
+// character typed.
+func readKey(r *bufio.Reader) (string, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	switch b {
+	case '\r', '\n':
+		return "enter", nil
+	case 3, 'q':
+		return "quit", nil
+	case 0x1b:
+		// a lone escape quits, the arrow keys send ESC [ A and ESC [ B
+		if r.Buffered() < 2 {
+			return "quit", nil
+		}
+		seq := make([]byte, 2)
+		if _, err := io.ReadFull(r, seq); err != nil {
+			return "", err
+		}
+		switch string(seq) {
+		case "[A", "OA":
+			return "up", nil
+		case "[B", "OB":
+			return "down", nil
+		}
+		return "", nil
+	}
+	return string(b), nil
+}
+
+// drawPicker draws the entries from top with the one at cursor highlighted,
+// first erasing the drawn lines of the previous frame, and returns the number of
+// lines it drew.
+func drawPicker(w *os.File, entries []pickerEntry, cursor, top, drawn int) int {
+	var b strings.Builder
+	if drawn > 0 {
+		fmt.Fprintf(&b, "\x1b[%dA\x1b[J", drawn)
+	}
+	b.WriteString("Pick the Go version to install (↑/↓, enter, q to quit):\r\n")
+	end := min(top+pickerRows, len(entries))
+	for i := top; i < end; i++ {
+		e := entries[i]
+		channel := "stable"
+		if !e.Stable {
+			channel = "unstable"
+		}
+		var notes []string
+		if e.Installed {
+			notes = append(notes, "installed")
+		}
+		if e.Backup {
+			notes = append(notes, "backup")
+		}
+		if e.Cached {
+			notes = append(notes, "cached")
+		}
+		line := fmt.Sprintf("%-14s %-8s %10s  %s", e.Version, channel, formatBytes(e.Size), strings.Join(notes, ", "))
+		if i == cursor {
+			line = "> " + colorize(w, colorGreen, line)
+		} else {
+			line = "  " + line
+		}
+		b.WriteString(line + "\r\n")
+	}
+	fmt.Fprintf(&b, "  %d of %d\r\n", cursor+1, len(entries))
+	w.WriteString(b.String())
+	return end - top + 2
+}
@@ -0,0 +1,76 @@
+package godl
+
+import (
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"golang.org/x/sys/execabs"
+)
+
+// darwinNativeArch returns the hardware architecture of a Mac. Under Rosetta both
+// `go version` and `uname -m` report amd64, but hw.optional.arm64 still tells an
+// Apple Silicon machine apart.
+func darwinNativeArch() (string, bool) {
+	out, err := execabs.Command("sysctl", "-n", "hw.optional.arm64").Output()
+	if err == nil && strings.TrimSpace(string(out)) == "1" {
+		return "arm64", true
+	}
+	out, err = execabs.Command("uname", "-m").Output()
+	if err != nil {
+		return "", false
+	}
+	switch strings.TrimSpace(string(out)) {
+	case "arm64":
+		return "arm64", true
+	case "x86_64":
+		return "amd64", true
+	}
+	return "", false
+}
+
+// HostPlatform returns the platform of the running machine as named by the go.dev
+// release files, e.g. linux and amd64. A godl built for amd64 running under
+// Rosetta on an Apple Silicon Mac reports arm64, and 32-bit ARM reports armv6l,
+// the variant Go publishes.
+func HostPlatform() (goos, goarch string) {
+	goos, goarch = runtime.GOOS, runtime.GOARCH
+	if goos == "darwin" && goarch == "amd64" {
+		if native, ok := darwinNativeArch(); ok {
+			goarch = native
+		}
+	}
+	return goos, releaseArch(goarch)
+}
+
+// checkRosetta warns when the installed toolchain reports darwin/amd64 on an Apple
+// Silicon Mac, which would install an emulated toolchain.
+func checkRosetta(iv InstalledVersion) {
+	if iv.Os != "darwin" || iv.Arch != "amd64" {
+		return
+	}
+	if native, ok := darwinNativeArch(); ok && native == "arm64" {
+		warnf("go reports darwin/amd64 but this Mac is arm64 (running under Rosetta?), pass -arch arm64 to install the native toolchain")
+	} else if runtime.GOARCH == "arm64" {
+		warnf("go reports darwin/amd64 but godl runs natively on arm64, pass -arch arm64 to install the native toolchain")
+	}
+}
+
+// isMusl reports whether this Linux system uses the musl C library, as Alpine does.
+// The dynamic loader is the telltale: musl installs /lib/ld-musl-<arch>.so.1 and
+// glibc /lib*/ld-linux*.so.*.
+func isMusl() bool {
+	musl, _ := filepath.Glob("/lib/ld-musl-*.so.1")
+	if len(musl) == 0 {
+		return false
+	}
+	glibc, _ := filepath.Glob("/lib*/ld-linux*.so.*")
+	return len(glibc) == 0
+}
+
+// checkMusl warns when a Linux toolchain is about to be installed on a musl system.
+func checkMusl(iv InstalledVersion) {
+	if iv.Os == "linux" && isMusl() {
+		warnf("this system uses musl libc, the official Go distribution targets glibc: the go command itself is static, but verify that cgo builds and the race detector work, e.g. with gcompat installed")
+	}
+}
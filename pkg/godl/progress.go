@@ -0,0 +1,298 @@
+package godl
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	progressInterval = 200 * time.Millisecond
+	// rateSmoothing is the weight of the latest sample in the throughput average.
+	rateSmoothing = 0.3
+	// etaWarmup is the number of samples needed before the average is trusted.
+	etaWarmup = 3
+	// progressLogInterval is the pause between two progress lines when stderr is
+	// not a terminal.
+	progressLogInterval = 10 * time.Second
+)
+
+// ProgressFunc receives the number of bytes downloaded so far and the expected
+// total, 0 when unknown. It is called from the downloading goroutine at most once
+// every 200ms while data arrives, and once more when the download ends, so it does
+// not have to throttle itself.
+type ProgressFunc func(downloaded, total int64)
+
+// progressWriter counts the bytes written through it and reports them to progress.
+type progressWriter struct {
+	w        io.Writer
+	total    int64
+	written  int64
+	last     time.Time
+	progress ProgressFunc
+	// bar is the CLI rendering used when no ProgressFunc was given
+	bar *progressBar
+
+	batch *batchProgress
+}
+
+// progressBar renders download progress on out, if out is set, and emits the
+// download events; it is the ProgressFunc of the command line. With lines set
+// it prints a line every progressLogInterval instead of redrawing one.
+type progressBar struct {
+	out         *os.File
+	last        time.Time
+	lastWritten int64
+	rate        float64
+	samples     int
+	lines       bool
+	lastLine    time.Time
+}
+
+// batch aggregates the progress of parallel downloads while it is set.
+var batch *batchProgress
+
+// batchProgress sums the bytes of several concurrent downloads into one line.
+type batchProgress struct {
+	mu      sync.Mutex
+	written int64
+	total   int64
+	files   int
+}
+
+// add records n more bytes written and total more bytes expected. It is a no-op
+// on a nil batchProgress.
+func (b *batchProgress) add(n, total int64) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.written += n
+	b.total += total
+	if total > 0 {
+		b.files++
+	}
+	b.mu.Unlock()
+}
+
+// run renders the aggregated progress on a terminal until the returned function
+// is called.
+func (b *batchProgress) run() func() {
+	if !isTerminal(os.Stderr.Fd()) {
+		return func() {}
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	render := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		fmt.Fprintf(os.Stderr, "\r%d downloads: %s / %s", b.files, formatBytes(b.written), formatBytes(b.total))
+	}
+	go func() {
+		defer close(stopped)
+		t := time.NewTicker(progressInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				render()
+				fmt.Fprintln(os.Stderr)
+				return
+			case <-t.C:
+				render()
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// newProgressWriter wraps w; total is the expected size, or 0 if unknown. progress
+// is called as bytes are written; when it is nil the progress bar is rendered, as
+// periodic lines when stderr is not a terminal or with -quiet-success, by the
+// batch progress instead during parallel downloads, and not at all with -quiet.
+func newProgressWriter(w io.Writer, total int64, progress ProgressFunc) *progressWriter {
+	p := &progressWriter{w: w, total: total, last: time.Now(), progress: progress, batch: batch}
+	if progress == nil {
+		p.bar = &progressBar{last: p.last, lastLine: p.last}
+		if batch == nil && !quiet {
+			p.bar.out = os.Stderr
+			p.bar.lines = quietSuccess || !isTerminal(os.Stderr.Fd())
+		}
+		p.progress = p.bar.update
+	}
+	p.batch.add(0, total)
+	return p
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.written += int64(n)
+	p.batch.add(int64(n), 0)
+	if now := time.Now(); now.Sub(p.last) >= progressInterval {
+		p.last = now
+		p.progress(p.written, p.total)
+	}
+	return n, err
+}
+
+// start records that offset bytes were written before, by an earlier attempt of
+// a resumed download.
+func (p *progressWriter) start(offset int64) {
+	p.written = offset
+	if p.bar != nil {
+		p.bar.lastWritten = offset
+	}
+}
+
+// finish reports the final state and ends the progress bar line.
+func (p *progressWriter) finish() {
+	if p.bar != nil {
+		p.bar.finish(p.written, p.total)
+		return
+	}
+	p.progress(p.written, p.total)
+}
+
+func (b *progressBar) update(written, total int64) {
+	b.sample(time.Now(), written)
+	b.render(written, total)
+	emit(streamEvent{Event: "download", Bytes: written, Total: total})
+}
+
+// sample folds the throughput since the previous sample into the smoothed rate.
+func (b *progressBar) sample(now time.Time, written int64) {
+	rate := float64(written-b.lastWritten) / now.Sub(b.last).Seconds()
+	if b.samples == 0 {
+		b.rate = rate
+	} else {
+		b.rate = rateSmoothing*rate + (1-rateSmoothing)*b.rate
+	}
+	b.samples++
+	b.last, b.lastWritten = now, written
+}
+
+// eta estimates the remaining time, or returns "--" when the size is unknown or
+// there are too few samples for the average to mean anything.
+func (b *progressBar) eta(written, total int64) string {
+	if total <= 0 || b.samples < etaWarmup || b.rate < 1 {
+		return "--"
+	}
+	left := time.Duration(float64(total-written)/b.rate) * time.Second
+	return left.Round(time.Second).String()
+}
+
+func (b *progressBar) render(written, total int64) {
+	if b.out == nil {
+		return
+	}
+	if b.lines {
+		if now := time.Now(); now.Sub(b.lastLine) >= progressLogInterval {
+			b.lastLine = now
+			b.line(written, total)
+		}
+		return
+	}
+	if total > 0 {
+		fmt.Fprintf(b.out, "\r%s / %s %3d%% %s/s ETA %-8s", formatBytes(written), formatBytes(total),
+			written*100/total, formatBytes(int64(b.rate)), b.eta(written, total))
+	} else {
+		fmt.Fprintf(b.out, "\r%s %s/s ", formatBytes(written), formatBytes(int64(b.rate)))
+	}
+}
+
+// line prints the progress as a line of its own.
+func (b *progressBar) line(written, total int64) {
+	if total > 0 {
+		fmt.Fprintf(b.out, "downloaded %s / %s (%d%%), %s/s, ETA %s\n", formatBytes(written), formatBytes(total),
+			written*100/total, formatBytes(int64(b.rate)), b.eta(written, total))
+	} else {
+		fmt.Fprintf(b.out, "downloaded %s, %s/s\n", formatBytes(written), formatBytes(int64(b.rate)))
+	}
+}
+
+// finish renders the final state and ends the progress line.
+func (b *progressBar) finish(written, total int64) {
+	emit(streamEvent{Event: "download", Bytes: written, Total: total})
+	if b.out == nil {
+		return
+	}
+	if b.lines {
+		b.line(written, total)
+		return
+	}
+	b.render(written, total)
+	fmt.Fprintln(b.out)
+}
+
+// progressReader renders how much of an archive has been read while it is being
+// extracted. The tar format carries no entry count, so progress is measured against
+// the size of the compressed archive.
+type progressReader struct {
+	r     io.Reader
+	out   *os.File
+	total int64
+	read  int64
+	last  time.Time
+}
+
+// newProgressReader wraps the archive f. Like the download progress it is only
+// rendered when stderr is a terminal.
+func newProgressReader(f *os.File) *progressReader {
+	p := &progressReader{r: f, last: time.Now()}
+	if info, err := f.Stat(); err == nil {
+		p.total = info.Size()
+	}
+	if isTerminal(os.Stderr.Fd()) {
+		p.out = os.Stderr
+	}
+	return p
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.read += int64(n)
+	if now := time.Now(); now.Sub(p.last) >= progressInterval {
+		p.last = now
+		p.render()
+	}
+	return n, err
+}
+
+func (p *progressReader) render() {
+	if p.out == nil {
+		return
+	}
+	if p.total > 0 {
+		fmt.Fprintf(p.out, "\rextracting %s / %s %3d%%", formatBytes(p.read), formatBytes(p.total), p.read*100/p.total)
+	} else {
+		fmt.Fprintf(p.out, "\rextracting %s", formatBytes(p.read))
+	}
+}
+
+// finish renders the final state and ends the progress line.
+func (p *progressReader) finish() {
+	if p.out == nil {
+		return
+	}
+	p.render()
+	fmt.Fprintln(p.out)
+}
+
+// formatBytes formats n using binary units.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,32 @@
+package godl
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// confirm asks question on stderr and reports whether the answer read from stdin
+// was yes. Without -yes it refuses to proceed when stdin is not a terminal, so
+// automation has to opt into destructive steps explicitly.
+func confirm(question string) (bool, error) {
+	if assumeYes {
+		return true, nil
+	}
+	if !isTerminal(os.Stdin.Fd()) {
+		return false, errors.New("stdin is not a terminal to confirm on, pass -yes to proceed")
+	}
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false, err
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
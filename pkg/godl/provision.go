@@ -0,0 +1,228 @@
+package godl
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Target is a Go installation managed by Provision.
+type Target struct {
+	// Name identifies the target in the results, e.g. a host name.
+	Name string
+	// OS and Arch select the release file, e.g. linux and amd64.
+	OS   string
+	Arch string
+	// GoRoot is where the toolchain is installed on the target.
+	GoRoot string
+	// Transport reads and replaces GoRoot, LocalTransport when nil.
+	Transport TargetTransport
+}
+
+// TargetTransport reaches the installation of a Target.
+type TargetTransport interface {
+	// Version returns the version installed in goRoot, empty when there is none.
+	Version(ctx context.Context, goRoot string) (string, error)
+	// Install replaces goRoot with the toolchain in archive, the verified release
+	// file described by file. When it fails the previous installation must be
+	// left in place.
+	Install(ctx context.Context, file File, archive, goRoot string) error
+}
+
+// ProvisionResult is the outcome of provisioning one Target.
+type ProvisionResult struct {
+	Target  Target
+	Version string
+	// Skipped reports that the target already had Version installed.
+	Skipped bool
+	Err     error
+}
+
+// ProvisionOptions controls Provision.
+type ProvisionOptions struct {
+	// Source is where the releases and their files come from, go.dev when zero.
+	Source Source
+	// Parallel is how many targets are provisioned at once, one when zero.
+	Parallel int
+}
+
+// Provision installs version, resolved like -version, on every target, at most
+// opts.Parallel at a time. Each release file is downloaded and verified once and
+// shared by all targets of its platform. Targets that already have the version are
+// skipped, so a partially failed run can be repeated for the same targets.
+func Provision(ctx context.Context, targets []Target, version string, opts ProvisionOptions) []ProvisionResult {
+	results := make([]ProvisionResult, len(targets))
+	for i, t := range targets {
+		results[i].Target = t
+	}
+	src := opts.Source
+	if src.isZero() {
+		src = defaultSource
+	}
+	rs, err := Releases(ctx, ReleaseOptions{Source: src, All: true, Channel: "all"})
+	if err == nil {
+		version, err = resolveVersion(rs, version)
+	}
+	if err != nil {
+		for i := range results {
+			results[i].Err = err
+		}
+		return results
+	}
+
+	archives := &sharedArchives{source: src, byName: make(map[string]*sharedArchive)}
+	defer archives.remove()
+	var (
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, max(opts.Parallel, 1))
+	)
+	for i := range results {
+		wg.Add(1)
+		go func(r *ProvisionResult) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			r.Version = version
+			r.Skipped, r.Err = provisionTarget(ctx, rs, archives, r.Target, version)
+		}(&results[i])
+	}
+	wg.Wait()
+	return results
+}
+
+// provisionTarget installs version on t unless it is already there.
+func provisionTarget(ctx context.Context, rs []Release, archives *sharedArchives, t Target, version string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	tr := t.Transport
+	if tr == nil {
+		tr = LocalTransport{}
+	}
+	if v, err := tr.Version(ctx, t.GoRoot); err != nil {
+		return false, errors.Wrap(err, "read installed version")
+	} else if v == version {
+		return true, nil
+	}
+	i := slices.IndexFunc(rs, func(r Release) bool { return r.Version == version })
+	if i < 0 {
+		return false, errors.Errorf("%s not found in the release list", version)
+	}
+	// the archive whatever -kind the command was given
+	file, err := (&Client{}).Archive(rs[i], t.OS, t.Arch)
+	if err != nil {
+		return false, err
+	}
+	archive, err := archives.get(ctx, file)
+	if err != nil {
+		return false, err
+	}
+	return false, tr.Install(ctx, file, archive, t.GoRoot)
+}
+
+// sharedArchives downloads every release file once for all the targets needing it.
+type sharedArchives struct {
+	source Source
+	mu     sync.Mutex
+	byName map[string]*sharedArchive
+}
+
+type sharedArchive struct {
+	once sync.Once
+	path string
+	temp bool
+	err  error
+}
+
+// get returns the path of the verified archive of file, downloading it on the
+// first call for the file.
+func (s *sharedArchives) get(ctx context.Context, file File) (string, error) {
+	s.mu.Lock()
+	a, ok := s.byName[file.Filename]
+	if !ok {
+		a = &sharedArchive{}
+		s.byName[file.Filename] = a
+	}
+	s.mu.Unlock()
+	a.once.Do(func() {
+		a.path, a.temp, a.err = fetchArchive(ctx, s.source, file)
+		if a.err == nil {
+			a.err = verifyArchive(file, a.path)
+		}
+	})
+	return a.path, a.err
+}
+
+// remove deletes the temporary downloads.
+func (s *sharedArchives) remove() {
+	for _, a := range s.byName {
+		if a.temp {
+			removeDownload(a.path)
+		}
+	}
+}
+
+// LocalTransport is the TargetTransport of installations on this machine. The
+// archive is staged next to GoRoot and installed with Install, which restores the
+// previous installation when the new one does not report the expected version.
+// GoRoot is locked like the command locks GOROOT, so that neither another godl
+// nor another target with the same GoRoot replaces it at the same time.
+type LocalTransport struct {
+	// LockTimeout is how long to wait for the lock of GoRoot, like -lock-timeout.
+	LockTimeout time.Duration
+}
+
+// Version returns the version in the VERSION file of goRoot.
+func (LocalTransport) Version(ctx context.Context, goRoot string) (string, error) {
+	v, err := readVersionFile(goRoot)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	return v, err
+}
+
+// Install extracts archive next to goRoot and moves it into place.
+func (t LocalTransport) Install(ctx context.Context, file File, archive, goRoot string) error {
+	if err := os.MkdirAll(filepath.Dir(goRoot), 0755); err != nil {
+		return err
+	}
+	unlock, err := acquireLock(ctx, lockPath(goRoot), t.LockTimeout)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	extractDir, staged, err := stageArchive(ctx, file, archive, goRoot)
+	if extractDir != "" {
+		defer removeStaging(extractDir)
+	}
+	if err != nil {
+		return err
+	}
+
+	previous, err := t.Version(ctx, goRoot)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(goRoot); os.IsNotExist(err) {
+		return os.Rename(staged, goRoot)
+	}
+	_, err = Install(ctx, file, InstallOptions{
+		GoRoot:          goRoot,
+		StagingDir:      staged,
+		PreviousVersion: previous,
+		NoBackup:        true,
+		Verify: func(goRoot string) error {
+			v, err := t.Version(ctx, goRoot)
+			if err == nil && v != fileVersion(file) {
+				err = errors.Errorf("%s holds %s, want %s", goRoot, v, fileVersion(file))
+			}
+			return err
+		},
+	})
+	return err
+}
@@ -0,0 +1,167 @@
+package godl
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memTransport is a TargetTransport of machines that only exist in memory, keyed
+// by GoRoot, recording the archives installed on them.
+type memTransport struct {
+	mu       sync.Mutex
+	versions map[string]string
+	// installed are the release files installed, in order
+	installed []string
+	// running and peak count the concurrent installs
+	running, peak int
+}
+
+func (m *memTransport) Version(ctx context.Context, goRoot string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.versions[goRoot], nil
+}
+
+func (m *memTransport) Install(ctx context.Context, file File, archive, goRoot string) error {
+	if _, err := os.Stat(archive); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.running++
+	m.peak = max(m.peak, m.running)
+	m.mu.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.running--
+	m.versions[goRoot] = file.Version
+	m.installed = append(m.installed, file.Filename)
+	return nil
+}
+
+// addPlatform publishes an archive of the existing release version for goos/goarch.
+func (s *fakeServer) addPlatform(t *testing.T, version, goos, goarch string) {
+	t.Helper()
+	data := fakeToolchain(t, version)
+	sum := sha256.Sum256(data)
+	f := File{
+		Filename: fmt.Sprintf("%s.%s-%s.tar.gz", version, goos, goarch),
+		Os:       goos,
+		Arch:     goarch,
+		Version:  version,
+		Sha256:   hex.EncodeToString(sum[:]),
+		Size:     len(data),
+		Kind:     "archive",
+	}
+	for i := range s.releases {
+		if s.releases[i].Version == version {
+			s.releases[i].Files = append(s.releases[i].Files, f)
+		}
+	}
+	s.files[f.Filename] = data
+}
+
+func TestProvisionLocalTargets(t *testing.T) {
+	testSettings(t)
+	srv := newFakeServer(t, "go1.21.5", "go1.22.1")
+	// the options, not the default source, name the server
+	opts := ProvisionOptions{Source: srv.source(), Parallel: 2}
+	defaultSource = Source{ReleasesURL: "http://127.0.0.1:1/", AllReleasesURL: "http://127.0.0.1:1/", DownloadURL: "http://127.0.0.1:1/"}
+	goos, goarch := HostPlatform()
+	dir := t.TempDir()
+	old := setupGoRootIn(t, filepath.Join(dir, "old"), "go1.21.5")
+	current := setupGoRootIn(t, filepath.Join(dir, "current"), "go1.22.1")
+	missing := filepath.Join(dir, "missing", "go")
+	targets := []Target{
+		{Name: "old", OS: goos, Arch: goarch, GoRoot: old},
+		{Name: "current", OS: goos, Arch: goarch, GoRoot: current},
+		{Name: "missing", OS: goos, Arch: goarch, GoRoot: missing},
+	}
+
+	results := Provision(context.Background(), targets, "go1.22", opts)
+	for _, r := range results {
+		if r.Err != nil || r.Version != "go1.22.1" || r.Skipped != (r.Target.Name == "current") {
+			t.Errorf("%s: %+v", r.Target.Name, r)
+		}
+		if v, err := readVersionFile(r.Target.GoRoot); err != nil || v != "go1.22.1" {
+			t.Errorf("%s has %q, %v, want go1.22.1", r.Target.GoRoot, v, err)
+		}
+	}
+	if n := srv.downloads.Load(); n != 1 {
+		t.Errorf("%d downloads for targets of one platform, want 1", n)
+	}
+
+	// repeating the run skips every target
+	for _, r := range Provision(context.Background(), targets, "go1.22.1", opts) {
+		if r.Err != nil || !r.Skipped {
+			t.Errorf("second run %s: %+v", r.Target.Name, r)
+		}
+	}
+}
+
+func TestProvisionLockedGoRoot(t *testing.T) {
+	testSettings(t)
+	srv := newFakeServer(t, "go1.21.5", "go1.22.1")
+	goos, goarch := HostPlatform()
+	goRoot := setupGoRoot(t, "go1.21.5")
+	unlock, err := acquireLock(context.Background(), lockPath(goRoot), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+
+	targets := []Target{{Name: "locked", OS: goos, Arch: goarch, GoRoot: goRoot}}
+	r := Provision(context.Background(), targets, "go1.22.1", ProvisionOptions{Source: srv.source()})[0]
+	if r.Err == nil {
+		t.Fatalf("installed into a locked GOROOT: %+v", r)
+	}
+	if v, _ := readVersionFile(goRoot); v != "go1.21.5" {
+		t.Errorf("GOROOT has %s, want go1.21.5", v)
+	}
+}
+
+func TestProvisionRemoteTargets(t *testing.T) {
+	testSettings(t)
+	// targets always get the archive
+	set(t, &kind, "installer")
+	srv := newFakeServer(t, "go1.22.1")
+	srv.addPlatform(t, "go1.22.1", "linux", "armv6l")
+	srv.addPlatform(t, "go1.22.1", "linux", "ppc64le")
+	m := &memTransport{versions: map[string]string{"/host0/go": "go1.21.5"}}
+	var targets []Target
+	for i := 0; i < 6; i++ {
+		// go version reports arm, the release files are published as armv6l
+		arch := "arm"
+		if i%2 == 1 {
+			arch = "ppc64le"
+		}
+		targets = append(targets, Target{Name: fmt.Sprint("host", i), OS: "linux", Arch: arch, GoRoot: fmt.Sprintf("/host%d/go", i), Transport: m})
+	}
+
+	for _, r := range Provision(context.Background(), targets, "go1.22.1", ProvisionOptions{Source: srv.source(), Parallel: 2}) {
+		if r.Err != nil || r.Skipped {
+			t.Errorf("%s: %+v", r.Target.Name, r)
+		}
+	}
+	if len(m.installed) != len(targets) {
+		t.Errorf("installed %v, want %d installs", m.installed, len(targets))
+	}
+	for _, tg := range targets {
+		if m.versions[tg.GoRoot] != "go1.22.1" {
+			t.Errorf("%s has %q, want go1.22.1", tg.Name, m.versions[tg.GoRoot])
+		}
+	}
+	if m.peak > 2 {
+		t.Errorf("%d installs ran at once, want at most 2", m.peak)
+	}
+	if n := srv.downloads.Load(); n != 2 {
+		t.Errorf("%d downloads for two platforms, want 2", n)
+	}
+}
@@ -0,0 +1,525 @@
+package godl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type File struct {
+	Filename string `json:"filename"`
+	Os       string `json:"os"`
+	Arch     string `json:"arch"`
+	Version  string `json:"version"`
+	Sha256   string `json:"sha256"`
+	Size     int    `json:"size"`
+	Kind     string `json:"kind"`
+}
+
+type Release struct {
+	Version string `json:"version"`
+	Stable  bool   `json:"stable"`
+	Files   []File `json:"files"`
+}
+
+type InstalledVersion struct {
+	Os      string `json:"os"`
+	Arch    string `json:"arch"`
+	Version string `json:"version"`
+}
+
+// ReleaseOptions filters the releases returned by Releases.
+type ReleaseOptions struct {
+	// Source is where releases are fetched from, defaultSource when zero.
+	Source Source
+	// All fetches the full release history instead of only the supported releases.
+	All bool
+	// Channel is stable (the default), rc, beta or all. Each channel includes the
+	// releases of the channels before it.
+	Channel string
+	// OS and Arch keep only the files of that platform when set, releases left
+	// without any file are dropped.
+	OS   string
+	Arch string
+	// Limit caps the number of releases returned, 0 means no limit.
+	Limit int
+}
+
+// Releases fetches the releases matching opts, newest first.
+func Releases(ctx context.Context, opts ReleaseOptions) ([]Release, error) {
+	if _, err := channelAllows(opts.Channel, Release{}); err != nil {
+		return nil, err
+	}
+	src := opts.Source
+	if src.isZero() {
+		src = defaultSource
+	}
+	fetch := src.getReleases
+	if opts.All {
+		fetch = src.getAllReleases
+	}
+	rs, err := fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []Release
+	for _, r := range rs {
+		if ok, _ := channelAllows(opts.Channel, r); !ok {
+			continue
+		}
+		if opts.OS != "" || opts.Arch != "" {
+			var files []File
+			for _, f := range r.Files {
+				if (opts.OS == "" || f.Os == opts.OS) && (opts.Arch == "" || f.Arch == opts.Arch) {
+					files = append(files, f)
+				}
+			}
+			if len(files) == 0 {
+				continue
+			}
+			r.Files = files
+		}
+		out = append(out, r)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return CompareVersions(out[i].Version, out[j].Version) > 0
+	})
+	if opts.Limit > 0 && len(out) > opts.Limit {
+		out = out[:opts.Limit]
+	}
+	return out, nil
+}
+
+// Platform is an operating system and architecture pair files are published for.
+type Platform struct {
+	OS   string `json:"os"`
+	Arch string `json:"arch"`
+}
+
+func (p Platform) String() string {
+	return p.OS + "/" + p.Arch
+}
+
+// SupportedPlatforms returns the distinct platforms of the files of rs, sorted by
+// OS and then architecture. Source archives have no platform and are left out.
+func SupportedPlatforms(rs []Release) []Platform {
+	seen := make(map[Platform]bool)
+	var out []Platform
+	for _, r := range rs {
+		for _, f := range r.Files {
+			p := Platform{OS: f.Os, Arch: f.Arch}
+			if p.OS == "" || p.Arch == "" || seen[p] {
+				continue
+			}
+			seen[p] = true
+			out = append(out, p)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].OS != out[j].OS {
+			return out[i].OS < out[j].OS
+		}
+		return out[i].Arch < out[j].Arch
+	})
+	return out
+}
+
+// checkPlatform returns an error naming the architectures that are available for
+// the OS of p when no file of rs is published for p.
+func checkPlatform(rs []Release, p Platform) error {
+	var arches []string
+	for _, sp := range SupportedPlatforms(rs) {
+		if sp == p {
+			return nil
+		}
+		if sp.OS == p.OS {
+			arches = append(arches, sp.Arch)
+		}
+	}
+	if len(arches) == 0 {
+		return withKind(ErrNoMatchingPlatform, errors.Errorf("no releases are published for %s", p.OS))
+	}
+	return withKind(ErrNoMatchingPlatform, errors.Errorf("no releases are published for %s, available architectures for %s: %s", p, p.OS, strings.Join(arches, ", ")))
+}
+
+// channelAllows reports whether r belongs to channel.
+func channelAllows(channel string, r Release) (bool, error) {
+	switch channel {
+	case "", "stable":
+		return r.Stable, nil
+	case "rc":
+		return r.Stable || strings.Contains(r.Version, "rc"), nil
+	case "beta":
+		return r.Stable || strings.Contains(r.Version, "rc") || strings.Contains(r.Version, "beta"), nil
+	case "all":
+		return true, nil
+	}
+	return false, errors.Errorf("invalid channel %q, want stable, rc, beta or all", channel)
+}
+
+func getNewVersionFile(ctx context.Context, fn func(ctx context.Context) ([]Release, error), iv InstalledVersion) (File, error) {
+	releases, err := fn(ctx)
+	if err != nil {
+		return File{}, err
+	}
+
+	whyf("installed %s %s/%s, %d releases to consider", iv.Version, iv.Os, iv.Arch, len(releases))
+	if len(releases) == 0 {
+		return File{}, errors.New("the release source returned no releases")
+	}
+	if _, err := channelAllows(releaseChannel, Release{}); err != nil {
+		return File{}, err
+	}
+	stable, platforms := 0, 0
+	for _, release := range releases {
+		if ok, _ := channelAllows(releaseChannel, release); !ok {
+			whyf("%s: skipped, not in the %s channel", release.Version, releaseChannel)
+			continue
+		}
+		stable++
+		platform := false
+		for _, file := range release.Files {
+			if kind != "" && file.Kind != kind {
+				continue
+			}
+			// source archives are the same for every platform
+			if file.Kind != "source" && (file.Os != iv.Os || iv.Arch != file.Arch) {
+				continue
+			}
+			platform = true
+			if versionGreater(fileVersion(file), iv.Version) {
+				whyf("%s: picked %s", release.Version, file.Filename)
+				return file, nil
+			}
+		}
+		if platform {
+			platforms++
+			whyf("%s: skipped, not newer than %s", release.Version, iv.Version)
+		} else {
+			whyf("%s: skipped, no %s file for %s/%s", release.Version, kind, iv.Os, iv.Arch)
+		}
+	}
+	switch {
+	case stable == 0:
+		return File{}, errors.Errorf("none of the %d releases from the release source is in the %s channel", len(releases), releaseChannel)
+	case platforms == 0:
+		return File{}, withKind(ErrNoMatchingPlatform, errors.Errorf("none of the %d %s releases has a %s file for %s/%s", stable, releaseChannel, kind, iv.Os, iv.Arch))
+	}
+	whyf("no release newer than %s", iv.Version)
+	return File{}, errors.Wrapf(ErrNoNewVersion, "installed %s", iv.Version)
+}
+
+// waitForRelease polls the release list every interval until a stable release
+// newer than iv is published and returns its file. It gives up after wait with
+// ErrNoNewVersion. Failed polls are reported and retried at the next interval.
+func waitForRelease(ctx context.Context, fn func(ctx context.Context) ([]Release, error), iv InstalledVersion, wait, interval time.Duration) (File, error) {
+	wctx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+	fmt.Fprintf(stdout, "waiting up to %s for a release newer than %s, polling every %s\n", wait, iv.Version, interval)
+	for polls := 1; ; polls++ {
+		select {
+		case <-wctx.Done():
+			if err := ctx.Err(); err != nil {
+				return File{}, err
+			}
+			return File{}, errors.Wrapf(ErrNoNewVersion, "no release newer than %s within %s", iv.Version, wait)
+		case <-time.After(interval):
+		}
+		file, err := getNewVersionFile(wctx, fn, iv)
+		logger.Debug("wait-for-release poll", "poll", polls, "err", err)
+		switch {
+		case err == nil:
+			return file, nil
+		case errors.Is(err, ErrNoNewVersion), wctx.Err() != nil:
+		case errors.Is(err, ErrNoMatchingPlatform):
+			return File{}, err
+		default:
+			warnf("poll %d: %s", polls, err)
+		}
+	}
+}
+
+// getVersionFile returns the file of release version for the platform of iv.
+func getVersionFile(ctx context.Context, fn func(ctx context.Context) ([]Release, error), iv InstalledVersion, version string) (File, error) {
+	releases, err := fn(ctx)
+	if err != nil {
+		return File{}, err
+	}
+	for _, release := range releases {
+		if release.Version != version {
+			continue
+		}
+		for _, file := range release.Files {
+			if kind != "" && file.Kind != kind {
+				continue
+			}
+			if file.Kind == "source" || (file.Os == iv.Os && file.Arch == iv.Arch) {
+				whyf("%s: picked %s", release.Version, file.Filename)
+				return file, nil
+			}
+		}
+		var platforms []string
+		for _, file := range release.Files {
+			if (kind == "" || file.Kind == kind) && file.Os != "" {
+				platforms = append(platforms, file.Os+"/"+file.Arch)
+			}
+		}
+		return File{}, withKind(ErrNoMatchingPlatform, errors.Errorf("%s has no %s file for %s/%s, available: %s", version, kind, iv.Os, iv.Arch, strings.Join(platforms, ", ")))
+	}
+	minor, _, _ := parseVersion(version)
+	return File{}, errors.Errorf("%s not found in the release list, available: %s", version, strings.Join(availableVersions(releases, minor), ", "))
+}
+
+// whyf prints a version selection decision when -why is set.
+func whyf(format string, args ...any) {
+	if why {
+		fmt.Fprintf(os.Stderr, "why: "+format+"\n", args...)
+	}
+}
+
+// getReleases fetches the lightweight listing, which only carries the currently
+// supported releases and is enough to find the latest one.
+func (s Source) getReleases(ctx context.Context) ([]Release, error) {
+	return s.fetchFirst(ctx, func(s Source) string { return s.ReleasesURL })
+}
+
+// getAllReleases fetches the full release history.
+func (s Source) getAllReleases(ctx context.Context) ([]Release, error) {
+	return s.fetchFirst(ctx, func(s Source) string { return s.AllReleasesURL })
+}
+
+// fetchFirst fetches the release list at the url of s, falling back to the
+// fallbacks of s in order until one succeeds.
+func (s Source) fetchFirst(ctx context.Context, url func(Source) string) ([]Release, error) {
+	settings := settingsOf(ctx)
+	var firstErr error
+	for i, c := range s.chain() {
+		rs, err := c.fetchReleases(ctx, url(c))
+		if err == nil {
+			if i > 0 {
+				fmt.Fprintln(settings.out, "using mirror: ", url(c))
+				settings.logger().Debug("release list from fallback mirror", "url", url(c))
+			}
+			return rs, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		if i+1 < len(s.chain()) {
+			settings.warnf("%s, trying the next mirror", err)
+		}
+	}
+	return nil, firstErr
+}
+
+// fetchReleases returns the release list at u, or the one in s.ReleasesFile or of
+// s.GitHubRepo when set, sorted newest first.
+func (s Source) fetchReleases(ctx context.Context, u string) ([]Release, error) {
+	var rs []Release
+	var err error
+	switch {
+	case s.ReleasesFile != "":
+		rs, err = readReleaseList(s.ReleasesFile)
+	case s.GitHubRepo != "":
+		rs, err = fetchGitHubReleases(ctx, s.GitHubRepo, s.GitHubToken)
+	default:
+		rs, err = fetchReleaseList(ctx, u)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// CompareVersions is a total order, so with a stable sort equal versions keep
+	// the order of the listing and every run sees the same order
+	sort.SliceStable(rs, func(i, j int) bool {
+		return CompareVersions(rs[i].Version, rs[j].Version) > 0
+	})
+	return rs, nil
+}
+
+// fetchReleaseList fetches and validates the release list at u, keeping the order
+// it is served in.
+func fetchReleaseList(ctx context.Context, u string) ([]Release, error) {
+	if settingsOf(ctx).metaCacheDir != "" {
+		return fetchCachedList(ctx, u)
+	}
+	c, err := httpGet(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkJSONResponse(u, c.StatusCode(), c.Headers().Get("Content-Type"), c.Body()); err != nil {
+		return nil, err
+	}
+	return decodeReleaseList(u, c.Body())
+}
+
+// readReleaseList reads and validates a release list saved in the go.dev JSON
+// format, e.g. with curl 'https://go.dev/dl/?mode=json&include=all'.
+func readReleaseList(path string) ([]Release, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read -releases-file")
+	}
+	return decodeReleaseList(path, b)
+}
+
+// decodeReleaseList decodes and validates the release list read from the named
+// url or file.
+func decodeReleaseList(from string, body []byte) ([]Release, error) {
+	var rs []Release
+	if err := json.Unmarshal(body, &rs); err != nil {
+		return nil, errors.Wrapf(err, "decode release list from %s, body: %s", from, bodySnippet(body))
+	}
+	if err := validateReleases(rs); err != nil {
+		return nil, errors.Wrapf(err, "release list from %s does not match the go.dev schema", from)
+	}
+	if len(rs) == 0 {
+		return nil, errors.Errorf("release list from %s is empty, check the metadata source", from)
+	}
+	return rs, nil
+}
+
+// validateReleases checks that decoded releases carry the fields of the go.dev
+// schema, catching endpoints that return some other JSON array.
+func validateReleases(rs []Release) error {
+	files := 0
+	for _, r := range rs {
+		files += len(r.Files)
+	}
+	if len(rs) > 0 && files == 0 {
+		return errors.Errorf("none of the %d releases lists any file", len(rs))
+	}
+	for i, r := range rs {
+		if !strings.HasPrefix(r.Version, "go") {
+			return errors.Errorf("release %d has invalid version %q", i, r.Version)
+		}
+		for j, f := range r.Files {
+			if f.Filename == "" || f.Kind == "" {
+				return errors.Errorf("%s file %d is missing its filename or kind", r.Version, j)
+			}
+		}
+	}
+	return nil
+}
+
+// checkJSONResponse rejects responses that cannot be a release list before they are
+// decoded, so a proxy login page or captive portal shows up as such rather than as
+// a JSON syntax error. Mirrors serving the list as a static file may not label it
+// as JSON, so only an explicit HTML response is refused.
+func checkJSONResponse(u string, status int, contentType string, body []byte) error {
+	html := strings.Contains(contentType, "html") || bytes.HasPrefix(bytes.TrimSpace(body), []byte("<"))
+	if status == http.StatusOK && !html {
+		return nil
+	}
+	return errors.Errorf("unexpected response from %s: status %d, content type %q, body: %s (is a proxy or captive portal intercepting the request?)",
+		u, status, contentType, bodySnippet(body))
+}
+
+// bodySnippet returns the start of body on a single line for error messages.
+func bodySnippet(body []byte) string {
+	const max = 200
+	s := strings.Join(strings.Fields(string(body)), " ")
+	if len(s) > max {
+		s = s[:max] + "..."
+	}
+	return s
+}
+
+var (
+	versionPattern  = regexp.MustCompile(`^go1(\.[0-9]+){0,2}((beta|rc)[0-9]+)?$`)
+	platformPattern = regexp.MustCompile(`^[a-z0-9]+$`)
+)
+
+// Filename returns the canonical go.dev file name of a release file, e.g.
+// go1.22.9.linux-amd64.tar.gz. kind is archive, installer or source; goos and goarch
+// are ignored for source archives.
+func Filename(version, goos, goarch, kind string) (string, error) {
+	if !versionPattern.MatchString(version) {
+		return "", errors.Errorf("invalid version %q", version)
+	}
+	if kind == "source" {
+		return version + ".src.tar.gz", nil
+	}
+	if !platformPattern.MatchString(goos) || !platformPattern.MatchString(goarch) {
+		return "", errors.Errorf("invalid platform %q/%q", goos, goarch)
+	}
+	base := version + "." + goos + "-" + goarch
+	switch kind {
+	case "", "archive":
+		if goos == "windows" {
+			return base + ".zip", nil
+		}
+		return base + ".tar.gz", nil
+	case "installer":
+		switch goos {
+		case "windows":
+			return base + ".msi", nil
+		case "darwin":
+			return base + ".pkg", nil
+		}
+		return "", errors.Errorf("no installer packages are published for %s", goos)
+	}
+	return "", errors.Errorf("invalid kind %q, want archive, installer or source", kind)
+}
+
+// archiveExts are the extensions used by go.dev release files, longest first.
+var archiveExts = []string{".tar.gz", ".zip", ".pkg", ".msi"}
+
+// releaseFilename returns the go.dev name of the kind file of version for the
+// platform of iv, without consulting the release list. The "go" prefix of
+// version is optional.
+func releaseFilename(version string, iv InstalledVersion, kind string) (string, error) {
+	if !strings.HasPrefix(version, "go") {
+		version = "go" + version
+	}
+	return Filename(version, iv.Os, iv.Arch, kind)
+}
+
+// releaseArch returns the architecture go.dev release files are published under
+// for goarch. 32-bit ARM toolchains, on Linux and the BSDs alike, are built for
+// ARMv6 and named armv6l, while go version reports plain arm.
+func releaseArch(goarch string) string {
+	if goarch == "arm" {
+		return "armv6l"
+	}
+	return goarch
+}
+
+// versionFromFilename returns the version encoded in a release file name,
+// e.g. go1.22rc1 for go1.22rc1.linux-amd64.tar.gz.
+func versionFromFilename(name string) string {
+	name = filepath.Base(name)
+	for _, ext := range archiveExts {
+		if strings.HasSuffix(name, ext) {
+			name = strings.TrimSuffix(name, ext)
+			break
+		}
+	}
+	if i := strings.LastIndex(name, "."); i > 0 {
+		return name[:i]
+	}
+	return name
+}
+
+// fileVersion returns the version of the file that will actually be downloaded.
+// The filename wins over the Version field so that prerelease spellings in the
+// metadata can never select one version and download another.
+func fileVersion(f File) string {
+	if v := versionFromFilename(f.Filename); strings.HasPrefix(v, "go") {
+		return v
+	}
+	return f.Version
+}
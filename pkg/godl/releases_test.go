@@ -0,0 +1,169 @@
+package godl
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestInstallPrerelease(t *testing.T) {
+	out := testSettings(t)
+	srv := newFakeServer(t, "go1.22.1")
+	srv.add(t, Release{Version: "go1.23rc1"}, fakeToolchain(t, "go1.23rc1"))
+	// the metadata spells the prerelease differently from the file name
+	srv.releases[1].Files[0].Version = "go1.23.0rc1"
+	goRoot := setupGoRoot(t, "go1.22.1")
+	hookOut := filepath.Join(t.TempDir(), "version")
+	set(t, &preInstall, `echo "$GODL_VERSION" > `+hookOut)
+	set(t, &wantVersion, "go1.23rc1")
+
+	if err := safeRun(context.Background()); err != nil {
+		t.Fatalf("run: %v\n%s", err, out)
+	}
+	if v, err := readVersionFile(goRoot); err != nil || v != "go1.23rc1" {
+		t.Fatalf("GOROOT has %q, %v, want go1.23rc1\n%s", v, err, out)
+	}
+	if result.File == nil || result.File.Filename != srv.file("go1.23rc1").Filename {
+		t.Errorf("selected %+v, want %s", result.File, srv.file("go1.23rc1").Filename)
+	}
+	if b, err := os.ReadFile(hookOut); err != nil || strings.TrimSpace(string(b)) != "go1.23rc1" {
+		t.Errorf("the pre-install hook saw GODL_VERSION %q, %v, want go1.23rc1", b, err)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(goRoot), "go@go1.22.1")); err != nil {
+		t.Errorf("no backup of go1.22.1: %v", err)
+	}
+}
+
+func TestFileVersion(t *testing.T) {
+	for _, tt := range []struct {
+		file File
+		want string
+	}{
+		{File{Filename: "go1.22rc1.linux-amd64.tar.gz", Version: "go1.22.0rc1"}, "go1.22rc1"},
+		{File{Filename: "go1.22.5.windows-amd64.zip", Version: "go1.22.5"}, "go1.22.5"},
+		{File{Filename: "go1.21beta1.darwin-arm64.pkg", Version: "go1.21beta1"}, "go1.21beta1"},
+		{File{Filename: "mirror/go1.20.14.src.tar.gz", Version: "go1.20.14"}, "go1.20.14"},
+		{File{Filename: "toolchain.tar.gz", Version: "go1.22.2"}, "go1.22.2"},
+	} {
+		if got := fileVersion(tt.file); got != tt.want {
+			t.Errorf("fileVersion(%s) = %s, want %s", tt.file.Filename, got, tt.want)
+		}
+	}
+}
+
+// platformFiles returns the archives of version for each os/arch in platforms.
+func platformFiles(version string, platforms ...string) []File {
+	var fs []File
+	for _, p := range platforms {
+		goos, goarch, _ := strings.Cut(p, "/")
+		ext := ".tar.gz"
+		if goos == "windows" {
+			ext = ".zip"
+		}
+		fs = append(fs, File{Filename: version + "." + goos + "-" + goarch + ext, Os: goos, Arch: goarch, Version: version, Kind: "archive"})
+	}
+	return fs
+}
+
+// releaseFixture is a release list in no particular order, with platforms that
+// overlap between releases and a source archive without a platform.
+var releaseFixture = []Release{
+	{Version: "go1.21.13", Stable: true, Files: platformFiles("go1.21.13", "linux/amd64", "darwin/arm64")},
+	{Version: "go1.23rc1", Files: platformFiles("go1.23rc1", "linux/amd64", "linux/arm64")},
+	{Version: "go1.22.10", Stable: true, Files: append(platformFiles("go1.22.10", "linux/amd64", "windows/amd64", "darwin/arm64"),
+		File{Filename: "go1.22.10.src.tar.gz", Version: "go1.22.10", Kind: "source"})},
+	{Version: "go1.23beta1", Files: platformFiles("go1.23beta1", "linux/amd64")},
+	{Version: "go1.22.2", Stable: true, Files: platformFiles("go1.22.2", "linux/amd64", "linux/arm64")},
+	{Version: "go1.22.9", Stable: true, Files: platformFiles("go1.22.9", "darwin/arm64")},
+}
+
+// releaseFileSource writes rs as a go.dev JSON release list and returns the source
+// reading it.
+func releaseFileSource(t *testing.T, rs []Release) Source {
+	t.Helper()
+	b, err := json.Marshal(rs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(t.TempDir(), "releases.json")
+	if err := os.WriteFile(p, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return Source{ReleasesFile: p}
+}
+
+func TestReleasesFilters(t *testing.T) {
+	src := releaseFileSource(t, releaseFixture)
+	for _, tt := range []struct {
+		opts ReleaseOptions
+		want []string
+	}{
+		{ReleaseOptions{}, []string{"go1.22.10", "go1.22.9", "go1.22.2", "go1.21.13"}},
+		{ReleaseOptions{Channel: "rc"}, []string{"go1.23rc1", "go1.22.10", "go1.22.9", "go1.22.2", "go1.21.13"}},
+		{ReleaseOptions{Channel: "all"}, []string{"go1.23rc1", "go1.23beta1", "go1.22.10", "go1.22.9", "go1.22.2", "go1.21.13"}},
+		{ReleaseOptions{Channel: "all", OS: "linux", Arch: "arm64"}, []string{"go1.23rc1", "go1.22.2"}},
+		{ReleaseOptions{OS: "darwin"}, []string{"go1.22.10", "go1.22.9", "go1.21.13"}},
+		{ReleaseOptions{Arch: "amd64", Limit: 2}, []string{"go1.22.10", "go1.22.2"}},
+		{ReleaseOptions{OS: "plan9"}, nil},
+	} {
+		opts := tt.opts
+		opts.Source = src
+		// the same list gives the same result every time
+		for range 3 {
+			rs, err := Releases(context.Background(), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, r := range rs {
+				got = append(got, r.Version)
+				for _, f := range r.Files {
+					if tt.opts.OS != "" && f.Os != tt.opts.OS || tt.opts.Arch != "" && f.Arch != tt.opts.Arch {
+						t.Errorf("%+v: %s has a file for %s/%s", tt.opts, r.Version, f.Os, f.Arch)
+					}
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("%+v: got %v, want %v", tt.opts, got, tt.want)
+			}
+		}
+	}
+	if _, err := Releases(context.Background(), ReleaseOptions{Source: src, Channel: "nightly"}); err == nil {
+		t.Error("an unknown channel was accepted")
+	}
+}
+
+func TestSupportedPlatforms(t *testing.T) {
+	got := SupportedPlatforms(releaseFixture)
+	want := []Platform{
+		{OS: "darwin", Arch: "arm64"},
+		{OS: "linux", Arch: "amd64"},
+		{OS: "linux", Arch: "arm64"},
+		{OS: "windows", Arch: "amd64"},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("SupportedPlatforms = %v, want %v", got, want)
+	}
+	if got := SupportedPlatforms(nil); len(got) != 0 {
+		t.Errorf("SupportedPlatforms(nil) = %v", got)
+	}
+}
+
+func TestCheckPlatform(t *testing.T) {
+	if err := checkPlatform(releaseFixture, Platform{OS: "linux", Arch: "arm64"}); err != nil {
+		t.Errorf("linux/arm64: %v", err)
+	}
+	err := checkPlatform(releaseFixture, Platform{OS: "linux", Arch: "riscv64"})
+	if !errors.Is(err, ErrNoMatchingPlatform) || !strings.Contains(err.Error(), "amd64, arm64") {
+		t.Errorf("linux/riscv64: %v, want the available linux architectures", err)
+	}
+	if err := checkPlatform(releaseFixture, Platform{OS: "plan9", Arch: "386"}); !errors.Is(err, ErrNoMatchingPlatform) {
+		t.Errorf("plan9/386: %v, want ErrNoMatchingPlatform", err)
+	}
+}
@@ -0,0 +1,110 @@
+package godl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"golang.org/x/sys/execabs"
+)
+
+// envReport is the diagnostic snapshot printed by -report.
+type envReport struct {
+	GoRoot             string   `json:"goroot"`
+	GoRootSource       string   `json:"goroot_source"`
+	InstalledVersion   string   `json:"installed_version"`
+	Platform           string   `json:"platform"`
+	LatestStable       string   `json:"latest_stable"`
+	UpgradeRecommended bool     `json:"upgrade_recommended"`
+	FreeBytes          uint64   `json:"free_bytes,omitempty"`
+	Issues             []string `json:"issues"`
+}
+
+// gatherReport collects the -report snapshot without changing anything. Failures
+// to detect a part are recorded as issues rather than returned.
+func gatherReport(ctx context.Context, src Source, iv InstalledVersion, goRoot string) envReport {
+	goos, goarch := HostPlatform()
+	r := envReport{
+		GoRoot:           goRoot,
+		GoRootSource:     "not set",
+		InstalledVersion: iv.Version,
+		Platform:         goos + "/" + goarch,
+		Issues:           []string{},
+	}
+	if goRoot != "" {
+		r.GoRootSource = "GOROOT environment variable"
+	}
+	if iv.Version == "" {
+		r.Issues = append(r.Issues, "no working go command found on PATH")
+	}
+
+	if rs, err := Releases(ctx, ReleaseOptions{Source: src}); err != nil {
+		r.Issues = append(r.Issues, "cannot fetch the release list: "+err.Error())
+	} else {
+		r.LatestStable = newestStable(rs)
+		r.UpgradeRecommended = iv.Version != "" && r.LatestStable != "" && CompareVersions(r.LatestStable, iv.Version) > 0
+	}
+
+	if goRoot == "" {
+		return r
+	}
+	if free, err := freeSpace(filepath.Dir(goRoot)); err == nil {
+		r.FreeBytes = free
+	} else {
+		r.Issues = append(r.Issues, "cannot determine free disk space: "+err.Error())
+	}
+	if p, err := execabs.LookPath("go"); err == nil {
+		if dir, _ := filepath.Abs(filepath.Dir(p)); dir != filepath.Join(goRoot, "bin") {
+			r.Issues = append(r.Issues, fmt.Sprintf("the go command on PATH is %s, not the one in GOROOT", p))
+		}
+	}
+	if runtime.GOOS == "linux" && isMusl() {
+		r.Issues = append(r.Issues, "this system uses musl libc, the official Go distribution targets glibc")
+	}
+	if iv.Os == "darwin" && iv.Arch == "amd64" && goarch == "arm64" {
+		r.Issues = append(r.Issues, "go reports darwin/amd64 on an arm64 Mac, the toolchain runs under Rosetta")
+	}
+	if !sameFilesystem(os.TempDir(), filepath.Dir(goRoot)) {
+		r.Issues = append(r.Issues, fmt.Sprintf("%s is on another filesystem than GOROOT, -staging auto extracts next to GOROOT", os.TempDir()))
+	}
+	return r
+}
+
+// printReport writes r to w, as JSON when asJSON is set.
+func printReport(w io.Writer, r envReport, asJSON bool) error {
+	if asJSON {
+		return json.NewEncoder(w).Encode(r)
+	}
+	installed := r.InstalledVersion
+	if installed == "" {
+		installed = "none"
+	}
+	action := "none, up to date"
+	switch {
+	case r.LatestStable == "":
+		action = "unknown, the latest release could not be determined"
+	case r.UpgradeRecommended:
+		action = "upgrade to " + r.LatestStable
+	case r.InstalledVersion == "":
+		action = "install " + r.LatestStable
+	}
+	fmt.Fprintf(w, "%-18s %s (%s)\n", "goroot:", r.GoRoot, r.GoRootSource)
+	fmt.Fprintf(w, "%-18s %s\n", "installed:", installed)
+	fmt.Fprintf(w, "%-18s %s\n", "platform:", r.Platform)
+	fmt.Fprintf(w, "%-18s %s\n", "latest stable:", r.LatestStable)
+	fmt.Fprintf(w, "%-18s %s\n", "recommended:", action)
+	if r.FreeBytes > 0 {
+		fmt.Fprintf(w, "%-18s %s\n", "free disk space:", formatBytes(int64(r.FreeBytes)))
+	}
+	if len(r.Issues) == 0 {
+		fmt.Fprintf(w, "%-18s none\n", "issues:")
+		return nil
+	}
+	fmt.Fprintf(w, "%-18s %s\n", "issues:", strings.Join(r.Issues, "\n"+strings.Repeat(" ", 19)))
+	return nil
+}
@@ -0,0 +1,70 @@
+package godl
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// runResult is the outcome of an install, update or download run, printed on
+// stdout with -output json.
+type runResult struct {
+	// Action is what the run did: up-to-date, update-available, downloaded,
+	// extracted, dry-run, installed or failed.
+	Action string `json:"action"`
+	// InstalledVersion is the version found before the run.
+	InstalledVersion string `json:"installed_version,omitempty"`
+	// Version is the selected release.
+	Version string `json:"version,omitempty"`
+	File    *File  `json:"file,omitempty"`
+	URL     string `json:"url,omitempty"`
+	// Path is where the release file or toolchain ended up.
+	Path   string `json:"path,omitempty"`
+	Backup string `json:"backup,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// result collects the outcome of the run for -output json.
+var result runResult
+
+// validateOutputFormat checks -output.
+func validateOutputFormat() error {
+	switch outputFormat {
+	case "", "text":
+		return nil
+	case "json":
+		if jsonStream {
+			return errors.New("-output json and -json-stream are mutually exclusive")
+		}
+		return nil
+	}
+	return errors.Errorf("invalid -output value %q, want text or json", outputFormat)
+}
+
+// selectRelease records file, served by src, as the selected release.
+func (r *runResult) selectRelease(src Source, file File) {
+	r.Version = fileVersion(file)
+	r.File = &file
+	r.URL = src.fileURL(file.Filename)
+}
+
+// done records the action taken and where its result is.
+func (r *runResult) done(action, path string) {
+	r.Action, r.Path = action, path
+}
+
+// printResult writes r as JSON to w when the run got as far as an action or
+// failed; the listing modes print their own JSON instead.
+func printResult(w io.Writer, r runResult, runErr error) error {
+	if runFailed(runErr) {
+		r.Action = "failed"
+		r.Error = runErr.Error()
+	}
+	if r.Action == "" {
+		return nil
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
@@ -0,0 +1,9 @@
+//go:build !unix && !windows
+
+package godl
+
+// sameFilesystem reports whether a and b live on the same filesystem. Without a
+// way to tell, they are assumed not to.
+func sameFilesystem(a, b string) bool {
+	return false
+}
@@ -0,0 +1,27 @@
+//go:build unix
+
+package godl
+
+import (
+	"os"
+	"syscall"
+)
+
+// sameFilesystem reports whether a and b live on the same device, so a rename
+// between them is possible.
+func sameFilesystem(a, b string) bool {
+	ia, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	ib, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	sa, ok := ia.Sys().(*syscall.Stat_t)
+	if !ok {
+		return false
+	}
+	sb, ok := ib.Sys().(*syscall.Stat_t)
+	return ok && sa.Dev == sb.Dev
+}
@@ -0,0 +1,20 @@
+package godl
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// sameFilesystem reports whether a and b live on the same volume, so a rename
+// between them is possible.
+func sameFilesystem(a, b string) bool {
+	va, err := filepath.Abs(a)
+	if err != nil {
+		return false
+	}
+	vb, err := filepath.Abs(b)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(filepath.VolumeName(va), filepath.VolumeName(vb))
+}
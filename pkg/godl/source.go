@@ -0,0 +1,136 @@
+package godl
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Source describes where release metadata and install packages are fetched from.
+type Source struct {
+	// ReleasesURL returns the currently supported releases in the go.dev JSON format.
+	ReleasesURL string
+	// AllReleasesURL returns every release ever published in the same format.
+	AllReleasesURL string
+	// ReleasesFile, when set, is read instead of ReleasesURL and AllReleasesURL, so
+	// that no release metadata is fetched over the network.
+	ReleasesFile string
+	// GitHubRepo, when set, is an owner/name repository whose GitHub releases are
+	// listed instead, with assets named like the go.dev release files.
+	GitHubRepo string
+	// GitHubToken authenticates the GitHub API requests when set.
+	GitHubToken string
+	// DevelURL returns development snapshots in the go.dev JSON format, newest
+	// first. go.dev publishes none, so it is only set for sources that build them.
+	DevelURL string
+	// DownloadURL is the base URL the release file names are resolved against.
+	DownloadURL string
+	// StripPrefix is removed from release file names before they are resolved.
+	StripPrefix string
+	// FilenamePrefix is prepended to release file names once StripPrefix is removed.
+	FilenamePrefix string
+	// Fallbacks are tried in order when this source fails to list the releases or
+	// to serve a file. The files are verified the same whichever source served them.
+	Fallbacks []Source
+}
+
+var defaultSource = Source{
+	ReleasesURL:    "https://go.dev/dl/?mode=json",
+	AllReleasesURL: "https://go.dev/dl/?mode=json&include=all",
+	DownloadURL:    "https://dl.google.com/go/",
+}
+
+// mirrors names the mirrors -mirror and -mirror-fallback accept besides URLs. The
+// mirrors serving only the files list the releases from golang.google.cn.
+var mirrors = map[string]Source{
+	"go.dev":           defaultSource,
+	"cn":               golangCN,
+	"golang.google.cn": golangCN,
+	"aliyun": {
+		ReleasesURL:    golangCN.ReleasesURL,
+		AllReleasesURL: golangCN.AllReleasesURL,
+		DownloadURL:    "https://mirrors.aliyun.com/golang/",
+	},
+	"ustc": {
+		ReleasesURL:    golangCN.ReleasesURL,
+		AllReleasesURL: golangCN.AllReleasesURL,
+		DownloadURL:    "https://mirrors.ustc.edu.cn/golang/",
+	},
+}
+
+var golangCN = Source{
+	ReleasesURL:    "https://golang.google.cn/dl/?mode=json",
+	AllReleasesURL: "https://golang.google.cn/dl/?mode=json&include=all",
+	DownloadURL:    "https://golang.google.cn/dl/",
+}
+
+// parseMirrors parses the comma separated -mirror-fallback list of parseMirror
+// entries.
+func parseMirrors(list string) ([]Source, error) {
+	var srcs []Source
+	for _, m := range strings.Split(list, ",") {
+		m = strings.TrimSpace(m)
+		if m == "" {
+			continue
+		}
+		s, err := parseMirror(m)
+		if err != nil {
+			return nil, errors.Wrap(err, "-mirror-fallback")
+		}
+		srcs = append(srcs, s)
+	}
+	return srcs, nil
+}
+
+// parseMirror returns the source named by m, a known mirror or the URL of one laid
+// out like go.dev/dl, serving the release list at <url>/?mode=json and the files
+// at <url>/<filename>.
+func parseMirror(m string) (Source, error) {
+	if s, ok := mirrors[m]; ok {
+		return s, nil
+	}
+	u, err := url.Parse(m)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		names := make([]string, 0, len(mirrors))
+		for name := range mirrors {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return Source{}, errors.Errorf("invalid mirror %q, want one of %s or an http(s) URL", m, strings.Join(names, ", "))
+	}
+	base := strings.TrimSuffix(m, "/")
+	return Source{
+		ReleasesURL:    base + "/?mode=json",
+		AllReleasesURL: base + "/?mode=json&include=all",
+		DownloadURL:    base + "/",
+	}, nil
+}
+
+// isZero reports whether s is the zero Source, which stands for defaultSource.
+func (s Source) isZero() bool {
+	return s.ReleasesURL == "" && s.AllReleasesURL == "" && s.DownloadURL == "" && s.DevelURL == "" &&
+		s.ReleasesFile == "" && s.GitHubRepo == "" && len(s.Fallbacks) == 0
+}
+
+// chain returns s followed by its fallbacks.
+func (s Source) chain() []Source {
+	return append([]Source{s}, s.Fallbacks...)
+}
+
+// fileURLs returns the download URLs of the named release file, from s first and
+// then from each fallback.
+func (s Source) fileURLs(filename string) []string {
+	var us []string
+	for _, c := range s.chain() {
+		us = append(us, c.fileURL(filename))
+	}
+	return us
+}
+
+// fileURL returns the download URL of the named release file.
+func (s Source) fileURL(filename string) string {
+	filename = s.FilenamePrefix + strings.TrimPrefix(filename, s.StripPrefix)
+	return strings.TrimSuffix(s.DownloadURL, "/") + "/" + strings.TrimPrefix(filename, "/")
+}
@@ -0,0 +1,299 @@
+package godl
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// set sets *p to v for the rest of the test.
+func set[T any](t *testing.T, p *T, v T) {
+	t.Helper()
+	old := *p
+	*p = v
+	t.Cleanup(func() { *p = old })
+}
+
+// testSettings gives the settings run reads the defaults of their flags, which
+// are only registered by Main, for a real install without prompts, and captures
+// the human output, which it returns.
+func testSettings(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake toolchains are shell scripts")
+	}
+	out := new(bytes.Buffer)
+	set(t, &stdout, io.Writer(out))
+	set(t, &dryRun, false)
+	set(t, &assumeYes, true)
+	set(t, &kind, "archive")
+	set(t, &backupDir, defaultBackupTemplate)
+	set(t, &releaseChannel, "stable")
+	set(t, &http2, "auto")
+	set(t, &staging, "auto")
+	set(t, &colorMode, "never")
+	set(t, &logFormat, "text")
+	set(t, &noDowngrade, true)
+	set(t, &resumeDownload, true)
+	set(t, &connections, 1)
+	set(t, &wantVersion, "")
+	set(t, &verifiers, []Verifier{sha256Verifier{}})
+	set(t, &metrics, runMetrics{})
+	set(t, &result, runResult{})
+	set(t, &defaultSource, defaultSource)
+	return out
+}
+
+// fakeServer serves a release list in the go.dev JSON format and the archives of
+// fake toolchains it names, laid out like go.dev/dl and dl.google.com/go.
+type fakeServer struct {
+	*httptest.Server
+	releases []Release
+	files    map[string][]byte
+	// downloads counts the requests for archives
+	downloads atomic.Int32
+}
+
+// newFakeServer starts a server publishing a stable release with a fake toolchain
+// for this platform for each of versions, and makes it the default source for
+// the rest of the test.
+func newFakeServer(t *testing.T, versions ...string) *fakeServer {
+	t.Helper()
+	s := &fakeServer{files: map[string][]byte{}}
+	for _, v := range versions {
+		s.add(t, Release{Version: v, Stable: !strings.Contains(v, "rc") && !strings.Contains(v, "beta")}, fakeToolchain(t, v))
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/dl/", func(w http.ResponseWriter, r *http.Request) {
+		// newest first, like go.dev
+		rs := append([]Release(nil), s.releases...)
+		sort.SliceStable(rs, func(i, j int) bool { return CompareVersions(rs[i].Version, rs[j].Version) > 0 })
+		json.NewEncoder(w).Encode(rs)
+	})
+	mux.HandleFunc("/go/", func(w http.ResponseWriter, r *http.Request) {
+		b, ok := s.files[strings.TrimPrefix(r.URL.Path, "/go/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		s.downloads.Add(1)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(b))
+	})
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	defaultSource = s.source()
+	return s
+}
+
+// add publishes r with data as the archive of the host platform.
+func (s *fakeServer) add(t *testing.T, r Release, data []byte) {
+	goos, goarch := HostPlatform()
+	sum := sha256.Sum256(data)
+	f := File{
+		Filename: fmt.Sprintf("%s.%s-%s.tar.gz", r.Version, goos, goarch),
+		Os:       goos,
+		Arch:     goarch,
+		Version:  r.Version,
+		Sha256:   hex.EncodeToString(sum[:]),
+		Size:     len(data),
+		Kind:     "archive",
+	}
+	r.Files = append(r.Files, f)
+	s.releases = append(s.releases, r)
+	s.files[f.Filename] = data
+}
+
+// source returns the source listing and serving the releases of s.
+func (s *fakeServer) source() Source {
+	return Source{
+		ReleasesURL:    s.URL + "/dl/?mode=json",
+		AllReleasesURL: s.URL + "/dl/?mode=json&include=all",
+		DownloadURL:    s.URL + "/go/",
+	}
+}
+
+// file returns the archive of version published by s.
+func (s *fakeServer) file(version string) File {
+	for _, r := range s.releases {
+		if r.Version == version {
+			return r.Files[0]
+		}
+	}
+	panic("no release " + version)
+}
+
+// fakeToolchain returns a .tar.gz of a go tree whose bin/go is a script
+// reporting version for this platform, as go version does.
+func fakeToolchain(t *testing.T, version string) []byte {
+	t.Helper()
+	goos, goarch := HostPlatform()
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for _, e := range []struct {
+		name string
+		mode int64
+		body string
+	}{
+		{"go/", 0755, ""},
+		{"go/VERSION", 0644, version + "\ntime 2024-01-01T00:00:00Z\n"},
+		{"go/bin/", 0755, ""},
+		{"go/bin/go", 0755, fmt.Sprintf("#!/bin/sh\necho go version %s %s/%s\n", version, goos, goarch)},
+		{"go/src/", 0755, ""},
+		{"go/src/runtime.go", 0644, "package runtime // " + version + "\n"},
+	} {
+		h := &tar.Header{Name: e.name, Mode: e.mode, Size: int64(len(e.body)), Typeflag: tar.TypeReg}
+		if strings.HasSuffix(e.name, "/") {
+			h.Typeflag = tar.TypeDir
+		}
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(tw, e.body)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// setupGoRoot extracts the fake toolchain of version into a new GOROOT, which it
+// puts first on PATH and returns.
+func setupGoRoot(t *testing.T, version string) string {
+	t.Helper()
+	return setupGoRootIn(t, t.TempDir(), version)
+}
+
+// setupGoRootIn is setupGoRoot with GOROOT at dir/go, creating dir.
+func setupGoRootIn(t *testing.T, dir, version string) string {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ExtractArchive(bytes.NewReader(fakeToolchain(t, version)), "go.tar.gz", dir, ExtractOptions{PreserveMode: true}); err != nil {
+		t.Fatal(err)
+	}
+	goRoot := filepath.Join(dir, "go")
+	t.Setenv("GOROOT", goRoot)
+	t.Setenv("PATH", filepath.Join(goRoot, "bin")+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return goRoot
+}
+
+func TestInstallFromFakeServer(t *testing.T) {
+	out := testSettings(t)
+	srv := newFakeServer(t, "go1.21.5", "go1.22.1")
+	goRoot := setupGoRoot(t, "go1.21.5")
+
+	if err := safeRun(context.Background()); err != nil {
+		t.Fatalf("run: %v\n%s", err, out)
+	}
+	if v, err := readVersionFile(goRoot); err != nil || v != "go1.22.1" {
+		t.Fatalf("GOROOT has %q, %v, want go1.22.1\n%s", v, err, out)
+	}
+	backup := filepath.Join(filepath.Dir(goRoot), "go@go1.21.5")
+	if v, err := readVersionFile(backup); err != nil || v != "go1.21.5" {
+		t.Errorf("backup %s has %q, %v, want go1.21.5", backup, v, err)
+	}
+	if n := srv.downloads.Load(); n != 1 {
+		t.Errorf("%d downloads, want 1", n)
+	}
+	if result.Action != "installed" || result.Version != "go1.22.1" {
+		t.Errorf("result %+v, want installed go1.22.1", result)
+	}
+	entries, err := os.ReadDir(filepath.Dir(goRoot))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if strings.Contains(e.Name(), "staging") {
+			t.Errorf("staging directory %s was left behind", e.Name())
+		}
+	}
+
+	// the second run finds nothing newer
+	out.Reset()
+	if err := safeRun(context.Background()); err != nil {
+		t.Fatalf("second run: %v\n%s", err, out)
+	}
+	if !strings.Contains(out.String(), "already on the latest stable: go1.22.1") {
+		t.Errorf("second run printed\n%s", out)
+	}
+	if n := srv.downloads.Load(); n != 1 {
+		t.Errorf("%d downloads after the second run, want 1", n)
+	}
+}
+
+func TestInstallChecksumMismatch(t *testing.T) {
+	out := testSettings(t)
+	srv := newFakeServer(t, "go1.21.5")
+	srv.add(t, Release{Version: "go1.22.1", Stable: true}, fakeToolchain(t, "go1.22.1"))
+	// the server serves another archive than the one the release list describes
+	srv.files[srv.file("go1.22.1").Filename] = fakeToolchain(t, "go1.22.0")
+	goRoot := setupGoRoot(t, "go1.21.5")
+
+	err := safeRun(context.Background())
+	if err == nil {
+		t.Fatalf("installed an archive with the wrong checksum\n%s", out)
+	}
+	if v, _ := readVersionFile(goRoot); v != "go1.21.5" {
+		t.Errorf("GOROOT has %s after a failed install, want go1.21.5", v)
+	}
+}
+
+func TestInstallBadArchiveLeavesGoRoot(t *testing.T) {
+	out := testSettings(t)
+	srv := newFakeServer(t, "go1.21.5")
+	// a published archive whose checksum matches but that escapes the staging tree
+	// half way through
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	gw.Write(tarArchive(t, dirEntry("go"), fileEntry("go/VERSION", "go1.22.1\n"), fileEntry("go/../../evil.txt", "pwned")))
+	gw.Close()
+	srv.add(t, Release{Version: "go1.22.1", Stable: true}, buf.Bytes())
+	goRoot := setupGoRoot(t, "go1.21.5")
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	if err := safeRun(context.Background()); err == nil {
+		t.Fatalf("installed a malicious archive\n%s", out)
+	}
+	if entries, _ := os.ReadDir(tmp); len(entries) != 0 {
+		t.Errorf("the staging tree was left in %s", tmp)
+	}
+	if v, _ := readVersionFile(goRoot); v != "go1.21.5" {
+		t.Errorf("GOROOT has %s after a failed install, want go1.21.5", v)
+	}
+	entries, err := os.ReadDir(filepath.Dir(goRoot))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the lock was taken before the download and stays for the next run
+	var names []string
+	for _, e := range entries {
+		if e.Name() != filepath.Base(lockPath(goRoot)) {
+			names = append(names, e.Name())
+		}
+	}
+	if len(names) != 1 {
+		t.Errorf("next to GOROOT: %v, want only go and the lock", names)
+	}
+}
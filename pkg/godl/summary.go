@@ -0,0 +1,60 @@
+package godl
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// runSummary is the outcome of a run written to -summary-json.
+type runSummary struct {
+	Started          time.Time     `json:"started"`
+	Finished         time.Time     `json:"finished"`
+	Success          bool          `json:"success"`
+	Error            string        `json:"error,omitempty"`
+	InstalledVersion string        `json:"installed_version,omitempty"`
+	UpgradeAvailable bool          `json:"upgrade_available"`
+	DownloadBytes    int64         `json:"download_bytes"`
+	Events           []streamEvent `json:"events"`
+}
+
+var (
+	summaryMu     sync.Mutex
+	summaryEvents []streamEvent
+)
+
+// recordEvent keeps e for the summary. Download progress is left out, only the
+// final download event of a transfer is kept.
+func recordEvent(e streamEvent) {
+	if summaryFile == "" || (e.Event == "download" && e.Bytes != e.Total) {
+		return
+	}
+	summaryMu.Lock()
+	summaryEvents = append(summaryEvents, e)
+	summaryMu.Unlock()
+}
+
+// writeSummary writes the summary of a run that started at start and ended with
+// runErr to path.
+func writeSummary(path string, start, now time.Time, m runMetrics, runErr error) error {
+	summaryMu.Lock()
+	events := append([]streamEvent{}, summaryEvents...)
+	summaryMu.Unlock()
+	s := runSummary{
+		Started:          start,
+		Finished:         now,
+		Success:          !runFailed(runErr),
+		InstalledVersion: m.InstalledVersion,
+		UpgradeAvailable: m.UpgradeAvailable,
+		DownloadBytes:    m.DownloadBytes,
+		Events:           events,
+	}
+	if !s.Success {
+		s.Error = runErr.Error()
+	}
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return replaceFile(path, append(b, '\n'))
+}
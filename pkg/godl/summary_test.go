@@ -0,0 +1,41 @@
+package godl
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestWriteSummarySuccess(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "summary.json")
+	start := time.Unix(1700000000, 0)
+	for _, tt := range []struct {
+		err     error
+		success bool
+		msg     string
+	}{
+		{nil, true, ""},
+		// check found an update, the run itself succeeded
+		{errors.Wrap(ErrUpdateAvailable, "go1.21.5 → go1.22.1"), true, ""},
+		{errors.New("download failed"), false, "download failed"},
+	} {
+		if err := writeSummary(path, start, start.Add(time.Second), runMetrics{UpgradeAvailable: true}, tt.err); err != nil {
+			t.Fatal(err)
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var s runSummary
+		if err := json.Unmarshal(b, &s); err != nil {
+			t.Fatal(err)
+		}
+		if s.Success != tt.success || s.Error != tt.msg || !s.UpgradeAvailable {
+			t.Errorf("summary of a run ending with %v: %+v, want success %v and error %q", tt.err, s, tt.success, tt.msg)
+		}
+	}
+}
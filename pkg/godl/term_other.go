@@ -0,0 +1,16 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd && !windows
+
+package godl
+
+import "github.com/pkg/errors"
+
+// isTerminal reports whether fd refers to a terminal, which is never assumed on
+// platforms without a known way to tell.
+func isTerminal(fd uintptr) bool {
+	return false
+}
+
+// makeRaw is not supported on platforms without a known terminal interface.
+func makeRaw(fd uintptr) (func(), error) {
+	return nil, errors.New("raw terminal input is not supported on this platform")
+}
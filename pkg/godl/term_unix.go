@@ -0,0 +1,24 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package godl
+
+import "golang.org/x/sys/unix"
+
+// makeRaw switches the terminal fd to reading single keys without echo, with
+// signal keys such as Ctrl-C delivered as bytes, and returns a function that
+// restores the previous state.
+func makeRaw(fd uintptr) (func(), error) {
+	old, err := unix.IoctlGetTermios(int(fd), ioctlGetTermios)
+	if err != nil {
+		return nil, err
+	}
+	raw := *old
+	raw.Lflag &^= unix.ECHO | unix.ICANON | unix.ISIG | unix.IEXTEN
+	raw.Iflag &^= unix.IXON | unix.ICRNL
+	raw.Cc[unix.VMIN] = 1
+	raw.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(int(fd), ioctlSetTermios, &raw); err != nil {
+		return nil, err
+	}
+	return func() { unix.IoctlSetTermios(int(fd), ioctlSetTermios, old) }, nil
+}
@@ -0,0 +1,36 @@
+package godl
+
+import "golang.org/x/sys/windows"
+
+// isTerminal reports whether fd refers to a console.
+func isTerminal(fd uintptr) bool {
+	var mode uint32
+	return windows.GetConsoleMode(windows.Handle(fd), &mode) == nil
+}
+
+// makeRaw switches the console input fd to reading single keys without echo,
+// with the arrow keys sent as escape sequences, enables escape sequences on the
+// stderr console, and returns a function that restores both.
+func makeRaw(fd uintptr) (func(), error) {
+	in := windows.Handle(fd)
+	var inMode uint32
+	if err := windows.GetConsoleMode(in, &inMode); err != nil {
+		return nil, err
+	}
+	raw := inMode&^(windows.ENABLE_LINE_INPUT|windows.ENABLE_ECHO_INPUT|windows.ENABLE_PROCESSED_INPUT) | windows.ENABLE_VIRTUAL_TERMINAL_INPUT
+	if err := windows.SetConsoleMode(in, raw); err != nil {
+		return nil, err
+	}
+	out := windows.Stderr
+	var outMode uint32
+	outErr := windows.GetConsoleMode(out, &outMode)
+	if outErr == nil {
+		windows.SetConsoleMode(out, outMode|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING)
+	}
+	return func() {
+		windows.SetConsoleMode(in, inMode)
+		if outErr == nil {
+			windows.SetConsoleMode(out, outMode)
+		}
+	}, nil
+}
@@ -0,0 +1,77 @@
+package godl
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http/httptrace"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// requestTrace records when the phases of one HTTP request started and ended.
+type requestTrace struct {
+	mu                   sync.Mutex
+	start                time.Time
+	dnsStart, dnsDone    time.Time
+	connStart, connDone  time.Time
+	tlsStart, tlsDone    time.Time
+	wroteRequest, f1Byte time.Time
+	reused               bool
+}
+
+// traceRequest returns ctx with an httptrace attached when -trace is set, and a
+// function printing the timing breakdown of the request for u once it is done.
+// Without -trace ctx is returned unchanged and the function does nothing.
+func traceRequest(ctx context.Context, u string) (context.Context, func()) {
+	if !settingsOf(ctx).trace {
+		return ctx, func() {}
+	}
+	t := &requestTrace{start: time.Now()}
+	now := func(p *time.Time) {
+		t.mu.Lock()
+		*p = time.Now()
+		t.mu.Unlock()
+	}
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { now(&t.dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { now(&t.dnsDone) },
+		ConnectStart:         func(string, string) { now(&t.connStart) },
+		ConnectDone:          func(string, string, error) { now(&t.connDone) },
+		TLSHandshakeStart:    func() { now(&t.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { now(&t.tlsDone) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { now(&t.wroteRequest) },
+		GotFirstResponseByte: func() { now(&t.f1Byte) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			t.reused = info.Reused
+			t.mu.Unlock()
+		},
+	})
+	return ctx, func() { fmt.Fprintf(os.Stderr, "trace %s: %s\n", u, t.breakdown(time.Now())) }
+}
+
+// breakdown formats the duration of every phase seen, ending the transfer at end.
+// With redirects or retries the phases of the last connection are reported.
+func (t *requestTrace) breakdown(end time.Time) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var parts []string
+	phase := func(name string, from, to time.Time) {
+		if !from.IsZero() && !to.IsZero() {
+			parts = append(parts, fmt.Sprintf("%s %s", name, to.Sub(from).Round(time.Millisecond)))
+		}
+	}
+	phase("dns", t.dnsStart, t.dnsDone)
+	phase("connect", t.connStart, t.connDone)
+	phase("tls", t.tlsStart, t.tlsDone)
+	phase("first byte", t.wroteRequest, t.f1Byte)
+	phase("transfer", t.f1Byte, end)
+	phase("total", t.start, end)
+	if t.reused {
+		parts = append(parts, "reused connection")
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,205 @@
+package godl
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// tlsVersions maps the accepted -min-tls values to their TLS version constants.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// configureTransport applies the transport flags to http.DefaultTransport, which is
+// what the e2http clients use for both the metadata and the archive requests. The
+// requests of a Client still go through the transport net/http was set up with.
+func configureTransport() error {
+	base := http.DefaultTransport
+	for {
+		w, ok := base.(interface{ unwrap() http.RoundTripper })
+		if !ok {
+			break
+		}
+		base = w.unwrap()
+	}
+	t := base.(*http.Transport).Clone()
+
+	switch http2 {
+	case "", "auto":
+	case "on":
+		t.ForceAttemptHTTP2 = true
+	case "off":
+		t.ForceAttemptHTTP2 = false
+		// a non-nil empty map disables the automatic HTTP/2 upgrade
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	default:
+		return errors.Errorf("invalid -http2 value %q, want auto, on or off", http2)
+	}
+
+	if maxIdleConns < 0 {
+		return errors.Errorf("invalid -max-idle-conns value %d", maxIdleConns)
+	}
+	t.MaxIdleConns = maxIdleConns
+	t.MaxIdleConnsPerHost = maxIdleConns
+
+	if responseHeaderTimeout != "" {
+		d, err := time.ParseDuration(responseHeaderTimeout)
+		if err != nil {
+			return errors.Wrap(err, "invalid -response-header-timeout")
+		}
+		t.ResponseHeaderTimeout = d
+	}
+
+	if minTLS != "" {
+		v, ok := tlsVersions[minTLS]
+		if !ok {
+			return errors.Errorf("invalid -min-tls value %q, want 1.0, 1.1, 1.2 or 1.3", minTLS)
+		}
+		if t.TLSClientConfig == nil {
+			t.TLSClientConfig = &tls.Config{}
+		}
+		t.TLSClientConfig.MinVersion = v
+	}
+
+	if proxyURL != "" {
+		u, err := url.Parse(proxyURL)
+		if err != nil || u.Host == "" {
+			return errors.Errorf("invalid -proxy URL %q", redactURL(proxyURL))
+		}
+		t.Proxy = http.ProxyURL(u)
+	}
+
+	if caCert != "" {
+		pem, err := os.ReadFile(caCert)
+		if err != nil {
+			return errors.Wrap(err, "read -cacert")
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.Errorf("no certificates found in -cacert %s", caCert)
+		}
+		if t.TLSClientConfig == nil {
+			t.TLSClientConfig = &tls.Config{}
+		}
+		t.TLSClientConfig.RootCAs = pool
+	}
+
+	if pinCert != "" {
+		pins, err := parsePins(pinCert)
+		if err != nil {
+			return err
+		}
+		if t.TLSClientConfig == nil {
+			t.TLSClientConfig = &tls.Config{}
+		}
+		t.TLSClientConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+			return checkPins(cs, pins)
+		}
+	}
+
+	var rt http.RoundTripper = t
+	if useNetrc {
+		if p := netrcPath(); p != "" {
+			if b, err := os.ReadFile(p); err == nil {
+				rt = netrcTransport{next: rt, logins: parseNetrc(string(b))}
+			} else if !os.IsNotExist(err) {
+				return errors.Wrap(err, "read netrc")
+			}
+		}
+	}
+	http.DefaultTransport = redirectGuard{next: rt, plain: base}
+	http.DefaultClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxRedirects {
+			return errors.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		return nil
+	}
+	return nil
+}
+
+// maxRedirects bounds the redirect chain of a download.
+const maxRedirects = 5
+
+// redactURL returns u without the password of its user info.
+func redactURL(u string) string {
+	p, err := url.Parse(u)
+	if err != nil {
+		return "<unparsable>"
+	}
+	return p.Redacted()
+}
+
+// redirectGuard fails redirect responses when -no-follow-redirects is set. It sits
+// in the transport rather than the client so that it also covers the e2http
+// clients, whose redirect policy cannot be configured. For the same reason it
+// passes the requests of a Client to plain, untouched by the flags.
+type redirectGuard struct {
+	next  http.RoundTripper
+	plain http.RoundTripper
+}
+
+func (g redirectGuard) RoundTrip(req *http.Request) (*http.Response, error) {
+	if settingsOf(req.Context()).client {
+		return g.plain.RoundTrip(req)
+	}
+	resp, err := g.next.RoundTrip(req)
+	if err != nil || !noFollowRedirects {
+		return resp, err
+	}
+	switch resp.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		resp.Body.Close()
+		return nil, errors.Errorf("%s redirects to %s and -no-follow-redirects is set", req.URL, resp.Header.Get("Location"))
+	}
+	return resp, nil
+}
+
+func (g redirectGuard) unwrap() http.RoundTripper {
+	return g.next
+}
+
+// parsePins parses the comma separated hex SHA-256 fingerprints of -pin-cert.
+// Colons between the bytes, as printed by openssl, are accepted.
+func parsePins(v string) (map[string]bool, error) {
+	pins := make(map[string]bool)
+	for _, p := range strings.Split(v, ",") {
+		p = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(p), ":", ""))
+		if b, err := hex.DecodeString(p); err != nil || len(b) != sha256.Size {
+			return nil, errors.Errorf("invalid -pin-cert fingerprint %q, want a hex SHA-256", p)
+		}
+		pins[p] = true
+	}
+	return pins, nil
+}
+
+// checkPins accepts the connection when the SHA-256 of the leaf certificate or of
+// its public key (SPKI) is one of pins. It runs after the regular chain
+// verification, so a pin narrows the trusted certificates and never widens them.
+func checkPins(cs tls.ConnectionState, pins map[string]bool) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("no peer certificate to check against -pin-cert")
+	}
+	leaf := cs.PeerCertificates[0]
+	certSum := sha256.Sum256(leaf.Raw)
+	spkiSum := sha256.Sum256(leaf.RawSubjectPublicKeyInfo)
+	cert, spki := hex.EncodeToString(certSum[:]), hex.EncodeToString(spkiSum[:])
+	if pins[cert] || pins[spki] {
+		return nil
+	}
+	return errors.Errorf("certificate of %s does not match -pin-cert: certificate %s, public key %s", cs.ServerName, cert, spki)
+}
@@ -0,0 +1,82 @@
+package godl
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// gpgHome returns a new gpg home directory holding a key for uid, and the file its
+// public key was exported to.
+func gpgHome(t *testing.T, uid string) (home, pub string) {
+	t.Helper()
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("no gpg")
+	}
+	// gpg-agent sockets must fit in a short path
+	home, err := os.MkdirTemp("", "gpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		exec.Command("gpgconf", "--homedir", home, "--kill", "all").Run()
+		os.RemoveAll(home)
+	})
+	gpg(t, home, nil, "--passphrase", "", "--quick-gen-key", uid, "ed25519", "sign", "never")
+	pub = filepath.Join(t.TempDir(), "key.asc")
+	gpg(t, home, nil, "--armor", "--output", pub, "--export", uid)
+	return home, pub
+}
+
+// gpg runs gpg with home as its home directory.
+func gpg(t *testing.T, home string, stdin []byte, args ...string) []byte {
+	t.Helper()
+	cmd := exec.Command("gpg", append([]string{"--batch", "--pinentry-mode", "loopback", "--homedir", home}, args...)...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("gpg %s: %v", strings.Join(args, " "), err)
+	}
+	return out
+}
+
+func TestSignatureVerifier(t *testing.T) {
+	testSettings(t)
+	srv := newFakeServer(t, "go1.22.1")
+	file := srv.file("go1.22.1")
+	archive := filepath.Join(t.TempDir(), file.Filename)
+	if err := os.WriteFile(archive, srv.files[file.Filename], 0644); err != nil {
+		t.Fatal(err)
+	}
+	signer, signerKey := gpgHome(t, "signer@example.com")
+	_, otherKey := gpgHome(t, "other@example.com")
+	srv.files[file.Filename+".asc"] = gpg(t, signer, srv.files[file.Filename], "--armor", "--detach-sign")
+
+	v := signatureVerifier{ctx: context.Background(), src: srv.source(), key: signerKey}
+	if err := v.Verify(file, archive); err != nil {
+		t.Errorf("signed by -signing-key: %v", err)
+	}
+	v.key = otherKey
+	if err := v.Verify(file, archive); err == nil {
+		t.Error("signed by another key than -signing-key, want an error")
+	}
+	// the user's keyring has the signer's key, but it is not the Go signing key
+	t.Setenv("GNUPGHOME", signer)
+	v.key = ""
+	if err := v.Verify(file, archive); err == nil || !strings.Contains(err.Error(), goSigningKey) {
+		t.Errorf("signed by a key of the keyring other than the Go signing key: %v, want an error naming it", err)
+	}
+	if err := os.WriteFile(archive, []byte("tampered"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	v.key = signerKey
+	if err := v.Verify(file, archive); err == nil {
+		t.Error("tampered file, want an error")
+	}
+}
@@ -0,0 +1,267 @@
+package godl
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// CompareVersions compares two Go versions such as go1.21rc2, go1.21.0 or go1.9.2
+// and returns -1, 0 or +1. A release without a patch number equals its .0 patch
+// release, and betas sort before release candidates, which sort before the release.
+// Development builds such as go1.24-abc123, as go version reports them, sort before
+// the betas of their line, and two of them on the same line compare equal.
+// Prerelease and patch numbers compare numerically, so the ordering is
+//
+//	go1.9.2rc2 < go1.9.2 < go1.10beta1 < go1.20 < go1.21-abc123 < go1.21rc2 < go1.21rc4 < go1.21 = go1.21.0 < go1.21.1 < go1.22.2 < go1.22.10
+func CompareVersions(a, b string) int {
+	ka, kb := versionKey(a), versionKey(b)
+	return slices.Compare(ka[:], kb[:])
+}
+
+// versionKey returns the components v is ordered by: major, minor, patch, the
+// prerelease rank (0 development build, 1 beta, 2 rc, 3 release) and the
+// prerelease number.
+func versionKey(v string) [5]int {
+	v = strings.TrimPrefix(v, "go")
+	pre, preNum := 3, 0
+	if i := strings.Index(v, "-"); i > 0 {
+		pre = 0
+		v = v[:i]
+	}
+	for rank, tag := range []string{"beta", "rc"} {
+		if i := strings.Index(v, tag); i > 0 {
+			pre = rank + 1
+			preNum, _ = strconv.Atoi(v[i+len(tag):])
+			v = v[:i]
+		}
+	}
+	var k [5]int
+	for i, p := range strings.SplitN(v, ".", 3) {
+		k[i], _ = strconv.Atoi(p)
+	}
+	k[3], k[4] = pre, preNum
+	return k
+}
+
+// resolveVersion returns the release of rs that spec names. The fewer components
+// spec has, the wider it matches: a spec with a patch number or a prerelease tag
+// must match exactly, e.g. go1.21.13, while a minor line such as go1.21, or just
+// go1, selects the newest stable release within that prefix. The "go" prefix is
+// optional.
+func resolveVersion(rs []Release, spec string) (string, error) {
+	if isConstraint(spec) {
+		return resolveConstraint(rs, spec)
+	}
+	if !strings.HasPrefix(spec, "go") {
+		spec = "go" + spec
+	}
+	if !versionPattern.MatchString(spec) {
+		return "", errors.Errorf("invalid version %q", spec)
+	}
+	minor, _, tail := parseVersion(spec)
+	precision := strings.Count(spec, ".") + 1
+	if precision == 3 || tail != "" {
+		for _, r := range rs {
+			if r.Version == spec {
+				return spec, nil
+			}
+		}
+		return "", errors.Errorf("%s not found in the release list, available: %s", spec, strings.Join(availableVersions(rs, minor), ", "))
+	}
+	best := ""
+	for _, r := range rs {
+		if m, _, _ := parseVersion(r.Version); !r.Stable || (precision == 2 && m != minor) {
+			continue
+		}
+		if best == "" || CompareVersions(r.Version, best) > 0 {
+			best = r.Version
+		}
+	}
+	if best == "" {
+		return "", errors.Errorf("no stable %s release found in the release list", spec)
+	}
+	return best, nil
+}
+
+// isConstraint reports whether spec is a version constraint such as 1.22.x or
+// ">=1.21 <1.23" rather than a single version.
+func isConstraint(spec string) bool {
+	return strings.ContainsAny(spec, "<>=!x*, ")
+}
+
+// resolveConstraint returns the newest stable release of rs matching every term of
+// spec. Terms are separated by spaces or commas and are either a comparison, one
+// of >=, >, <=, <, = and != followed by a version, or a version ending in .x or .*
+// that matches its line, e.g. 1.22.x for every go1.22 patch release.
+func resolveConstraint(rs []Release, spec string) (string, error) {
+	var terms []func(v string) bool
+	for _, t := range strings.FieldsFunc(spec, func(r rune) bool { return r == ' ' || r == ',' }) {
+		term, err := constraintTerm(t)
+		if err != nil {
+			return "", errors.Wrapf(err, "invalid version constraint %q", spec)
+		}
+		terms = append(terms, term)
+	}
+	if len(terms) == 0 {
+		return "", errors.Errorf("invalid version constraint %q", spec)
+	}
+	best := ""
+	for _, r := range rs {
+		if !r.Stable || (best != "" && CompareVersions(r.Version, best) <= 0) {
+			continue
+		}
+		ok := true
+		for _, term := range terms {
+			ok = ok && term(r.Version)
+		}
+		if ok {
+			best = r.Version
+		}
+	}
+	if best == "" {
+		return "", errors.Errorf("no stable release matches %q", spec)
+	}
+	return best, nil
+}
+
+// constraintTerm parses one term of a version constraint.
+func constraintTerm(t string) (func(v string) bool, error) {
+	op := strings.TrimRight(t, "go0123456789.xX*betarc")
+	v := t[len(op):]
+	if !strings.HasPrefix(v, "go") {
+		v = "go" + v
+	}
+	if line, ok := strings.CutSuffix(v, ".x"); ok || strings.HasSuffix(v, ".*") || strings.HasSuffix(v, ".X") {
+		if !ok {
+			line = v[:len(v)-2]
+		}
+		if op != "" || !versionPattern.MatchString(line) {
+			return nil, errors.Errorf("bad term %q", t)
+		}
+		return func(v string) bool { return v == line || strings.HasPrefix(v, line+".") }, nil
+	}
+	if !versionPattern.MatchString(v) {
+		return nil, errors.Errorf("bad version in %q", t)
+	}
+	switch op {
+	case ">=":
+		return func(r string) bool { return CompareVersions(r, v) >= 0 }, nil
+	case ">":
+		return func(r string) bool { return CompareVersions(r, v) > 0 }, nil
+	case "<=":
+		return func(r string) bool { return CompareVersions(r, v) <= 0 }, nil
+	case "<":
+		return func(r string) bool { return CompareVersions(r, v) < 0 }, nil
+	case "=", "==", "":
+		return func(r string) bool { return CompareVersions(r, v) == 0 }, nil
+	case "!=":
+		return func(r string) bool { return CompareVersions(r, v) != 0 }, nil
+	}
+	return nil, errors.Errorf("bad operator in %q", t)
+}
+
+// availableVersions lists the versions of rs on the go1.minor line, or the five
+// newest of rs when there are none, to suggest instead of a missing version.
+func availableVersions(rs []Release, minor int) []string {
+	var line, all []string
+	for _, r := range rs {
+		if m, _, _ := parseVersion(r.Version); m == minor {
+			line = append(line, r.Version)
+		}
+		all = append(all, r.Version)
+	}
+	if len(line) > 0 {
+		return line
+	}
+	slices.SortFunc(all, func(a, b string) int { return CompareVersions(b, a) })
+	return all[:min(len(all), 5)]
+}
+
+// versionLess reports whether a is an older version than b. It is a strict weak
+// ordering backed by CompareVersions, so versionLess(v, v) is false.
+func versionLess(a, b string) bool {
+	return CompareVersions(a, b) < 0
+}
+
+// versionGreater reports whether a is a newer version than b, see CompareVersions.
+func versionGreater(a, b string) bool {
+	return CompareVersions(a, b) > 0
+}
+
+// checkDowngrade warns when selected is older than the installed version, or
+// returns an error if refuse is set.
+func checkDowngrade(installed, selected string, refuse bool) error {
+	if installed == "" || CompareVersions(selected, installed) >= 0 {
+		return nil
+	}
+	if refuse {
+		return errors.Errorf("refusing to downgrade %s → %s, set -no-downgrade=false to install it anyway", installed, selected)
+	}
+	warnf("downgrading %s → %s", installed, selected)
+	return nil
+}
+
+// parseVersion splits a go1 version such as go1.22.5rc1 into its minor and patch
+// numbers and the prerelease tail, which for a development build such as
+// go1.24-abc123 is the -abc123 suffix. Missing components are 0, so go1.22 and
+// go1.22.0 parse the same.
+func parseVersion(v string) (minor, patch int, tail string) {
+	if i := strings.Index(v, "-"); i > 0 {
+		tail = v[i:]
+		v = v[:i]
+	}
+	if i := strings.Index(v, "beta"); i > 0 {
+		tail = v[i:]
+		v = v[:i]
+	}
+	if i := strings.Index(v, "rc"); i > 0 {
+		tail = v[i:]
+		v = v[:i]
+	}
+	p := strings.Split(strings.TrimPrefix(v, "go1."), ".")
+	minor, _ = strconv.Atoi(p[0])
+	if len(p) < 2 {
+		return
+	}
+	patch, _ = strconv.Atoi(p[1])
+	return
+}
+
+// unsupportedLine reports whether the minor line of v is older than the two newest
+// stable minor lines in rs, which are the ones Go supports, and returns that line.
+// go.dev does not publish the support status, so this is a heuristic.
+func unsupportedLine(rs []Release, v string) (int, bool) {
+	var lines []int
+	for _, r := range rs {
+		if m, _, _ := parseVersion(r.Version); r.Stable && !slices.Contains(lines, m) {
+			lines = append(lines, m)
+		}
+	}
+	if len(lines) < 2 {
+		return 0, false
+	}
+	slices.Sort(lines)
+	minor, _, _ := parseVersion(v)
+	return minor, minor < lines[len(lines)-2]
+}
+
+// newestStable returns the newest stable version in rs.
+func newestStable(rs []Release) string {
+	best := ""
+	for _, r := range rs {
+		if r.Stable && (best == "" || CompareVersions(r.Version, best) > 0) {
+			best = r.Version
+		}
+	}
+	return best
+}
+
+// minorGap returns how many minor versions b is ahead of a, e.g. 2 for go1.20.5 and go1.22.1.
+func minorGap(a, b string) int {
+	mina, _, _ := parseVersion(a)
+	minb, _, _ := parseVersion(b)
+	return minb - mina
+}
@@ -0,0 +1,275 @@
+package godl
+
+import (
+	"context"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// orderedVersions are real Go versions, and development builds as go version
+// reports them, from oldest to newest.
+var orderedVersions = []string{
+	"go1.4beta1",
+	"go1.4rc1",
+	"go1.4",
+	"go1.4.3",
+	"go1.9.2rc2",
+	"go1.9.2",
+	"go1.9.7",
+	"go1.10beta1",
+	"go1.10beta2",
+	"go1.10rc1",
+	"go1.10rc2",
+	"go1.10",
+	"go1.10.1",
+	"go1.10.8",
+	"go1.19.9",
+	"go1.19.10",
+	"go1.19.13",
+	"go1.20rc1",
+	"go1.20rc3",
+	"go1.20",
+	"go1.20.1",
+	"go1.20.2",
+	"go1.20.14",
+	"go1.21-abc123",
+	"go1.21rc2",
+	"go1.21rc3",
+	"go1.21rc4",
+	"go1.21.0",
+	"go1.21.1",
+	"go1.21.9",
+	"go1.21.10",
+	"go1.21.13",
+	"go1.22rc1",
+	"go1.22rc2",
+	"go1.22.0",
+	"go1.22.1",
+	"go1.22.2",
+	"go1.22.10",
+	"go1.23rc1",
+	"go1.23rc2",
+	"go1.23.0",
+	"go1.23.4",
+	"go1.24-a1b2c3d4",
+	"go1.24rc1",
+	"go1.24rc3",
+	"go1.24.0",
+	"go1.24.1",
+}
+
+func TestCompareVersionsSortsShuffled(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	for i := 0; i < 50; i++ {
+		vs := slices.Clone(orderedVersions)
+		r.Shuffle(len(vs), func(i, j int) { vs[i], vs[j] = vs[j], vs[i] })
+		slices.SortFunc(vs, CompareVersions)
+		if !slices.Equal(vs, orderedVersions) {
+			t.Fatalf("sorted to\n%v\nwant\n%v", vs, orderedVersions)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	for _, tt := range []struct {
+		a, b string
+		want int
+	}{
+		{"go1.21rc4", "go1.21", -1},
+		{"go1.21", "go1.21.1", -1},
+		{"go1.21rc4", "go1.21.1", -1},
+		{"go1.21", "go1.21.0", 0},
+		{"go1.21rc10", "go1.21rc9", 1},
+		{"go1.21beta1", "go1.21rc1", -1},
+		{"go1.9", "go1.10beta1", -1},
+		{"go1.24-abc123", "go1.23.4", 1},
+		{"go1.24-abc123", "go1.24rc1", -1},
+		{"go1.24-abc123", "go1.24beta1", -1},
+		{"go1.24-abc123", "go1.24-def456", 0},
+		{"go1.24-abc123", "go1.25-abc123", -1},
+	} {
+		if got := CompareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareVersions(%s, %s) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := CompareVersions(tt.b, tt.a); got != -tt.want {
+			t.Errorf("CompareVersions(%s, %s) = %d, want %d", tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	for _, tt := range []struct {
+		v            string
+		minor, patch int
+		tail         string
+	}{
+		{"go1.22", 22, 0, ""},
+		{"go1.22.0", 22, 0, ""},
+		{"go1.22.5", 22, 5, ""},
+		{"go1.22rc1", 22, 0, "rc1"},
+		{"go1.10beta2", 10, 0, "beta2"},
+		{"go1.9.2rc2", 9, 2, "rc2"},
+		{"go1.24-abc123", 24, 0, "-abc123"},
+	} {
+		minor, patch, tail := parseVersion(tt.v)
+		if minor != tt.minor || patch != tt.patch || tail != tt.tail {
+			t.Errorf("parseVersion(%s) = %d, %d, %q, want %d, %d, %q", tt.v, minor, patch, tail, tt.minor, tt.patch, tt.tail)
+		}
+	}
+}
+
+// lineReleases has several patch releases per minor line, listed out of order,
+// with prereleases of the next lines.
+var lineReleases = []Release{
+	{Version: "go1.21.1", Stable: true},
+	{Version: "go1.21.13", Stable: true},
+	{Version: "go1.21.9", Stable: true},
+	{Version: "go1.21rc4"},
+	{Version: "go1.21.0", Stable: true},
+	{Version: "go1.22.2", Stable: true},
+	{Version: "go1.22.10", Stable: true},
+	{Version: "go1.22.5", Stable: true},
+	{Version: "go1.23rc1"},
+}
+
+func TestResolveVersionMinorLine(t *testing.T) {
+	for spec, want := range map[string]string{
+		"go1.21": "go1.21.13",
+		"1.21":   "go1.21.13",
+		"go1.22": "go1.22.10",
+		"go1":    "go1.22.10",
+	} {
+		if got, err := resolveVersion(lineReleases, spec); err != nil || got != want {
+			t.Errorf("resolveVersion(%s) = %s, %v, want %s", spec, got, err, want)
+		}
+	}
+	// a line with only prereleases has no stable release to pick
+	if got, err := resolveVersion(lineReleases, "go1.23"); err == nil {
+		t.Errorf("resolveVersion(go1.23) = %s, want an error", got)
+	}
+}
+
+func TestCompareVersionsIsTotalOrder(t *testing.T) {
+	// equal versions spelled differently make the sample harder
+	sample := append(slices.Clone(orderedVersions), "go1.21", "go1.22", "go1.24-ffffff", "go1.4.0")
+	for _, a := range sample {
+		for _, b := range sample {
+			ab, ba := CompareVersions(a, b), CompareVersions(b, a)
+			if ab != -ba {
+				t.Errorf("CompareVersions(%s, %s) = %d but CompareVersions(%s, %s) = %d", a, b, ab, b, a, ba)
+			}
+			for _, c := range sample {
+				if ab <= 0 && CompareVersions(b, c) <= 0 && CompareVersions(a, c) > 0 {
+					t.Errorf("%s <= %s <= %s but %s > %s", a, b, c, a, c)
+				}
+			}
+		}
+	}
+}
+
+func TestReleasesSortStable(t *testing.T) {
+	var rs []Release
+	for _, v := range orderedVersions {
+		rs = append(rs, Release{Version: v, Files: platformFiles(v, "linux/amd64")})
+	}
+	// go1.21 and go1.21.0 compare equal, a stable sort keeps them in listing order
+	rs = append(rs, Release{Version: "go1.21", Files: platformFiles("go1.21", "linux/amd64")})
+	rand.New(rand.NewPCG(3, 4)).Shuffle(len(rs), func(i, j int) { rs[i], rs[j] = rs[j], rs[i] })
+	src := releaseFileSource(t, rs)
+
+	var first []string
+	for i := 0; i < 5; i++ {
+		got, err := Releases(context.Background(), ReleaseOptions{Source: src, Channel: "all"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var vs []string
+		for _, r := range got {
+			vs = append(vs, r.Version)
+		}
+		if !slices.IsSortedFunc(vs, func(a, b string) int { return CompareVersions(b, a) }) {
+			t.Fatalf("not sorted newest first: %v", vs)
+		}
+		if first == nil {
+			first = vs
+		} else if !slices.Equal(vs, first) {
+			t.Fatalf("sorted to\n%v\nthen to\n%v", first, vs)
+		}
+	}
+}
+
+func TestResolveVersionPrecision(t *testing.T) {
+	for _, tt := range []struct {
+		spec, want string
+	}{
+		// a patch number must match exactly, even with newer patches available
+		{"go1.22.5", "go1.22.5"},
+		{"1.22.2", "go1.22.2"},
+		{"go1.21.0", "go1.21.0"},
+		// a prerelease tag as well
+		{"go1.21rc4", "go1.21rc4"},
+		// fewer components select the newest stable release within the prefix
+		{"go1.22", "go1.22.10"},
+		{"go1", "go1.22.10"},
+	} {
+		if got, err := resolveVersion(lineReleases, tt.spec); err != nil || got != tt.want {
+			t.Errorf("resolveVersion(%s) = %s, %v, want %s", tt.spec, got, err, tt.want)
+		}
+	}
+	// a missing patch suggests the releases of its line
+	if _, err := resolveVersion(lineReleases, "go1.22.3"); err == nil || !strings.Contains(err.Error(), "go1.22.2, go1.22.10, go1.22.5") {
+		t.Errorf("resolveVersion(go1.22.3): %v, want the go1.22 releases suggested", err)
+	}
+	for _, spec := range []string{"go1.22.3", "go1.21rc1", "go1.22.", "go1.x.2"} {
+		if got, err := resolveVersion(lineReleases, spec); err == nil {
+			t.Errorf("resolveVersion(%s) = %s, want an error", spec, got)
+		}
+	}
+}
+
+func TestVersionLessIrreflexive(t *testing.T) {
+	for _, v := range append(slices.Clone(orderedVersions), "go1.21", "go1.22.0rc1", "go1.10beta2", "go1.24-abc123") {
+		if versionLess(v, v) {
+			t.Errorf("versionLess(%s, %s) = true", v, v)
+		}
+		if versionGreater(v, v) {
+			t.Errorf("versionGreater(%s, %s) = true", v, v)
+		}
+	}
+	// equal versions spelled differently are not less in either order
+	for _, p := range [][2]string{{"go1.21", "go1.21.0"}, {"go1.24-abc123", "go1.24-def456"}} {
+		if versionLess(p[0], p[1]) || versionLess(p[1], p[0]) {
+			t.Errorf("%s and %s are less than each other", p[0], p[1])
+		}
+	}
+	for i := 1; i < len(orderedVersions); i++ {
+		a, b := orderedVersions[i-1], orderedVersions[i]
+		if !versionLess(a, b) || versionLess(b, a) || !versionGreater(b, a) {
+			t.Errorf("want %s < %s", a, b)
+		}
+	}
+}
+
+func TestPatchOrdering(t *testing.T) {
+	for _, tt := range []struct {
+		older, newer string
+	}{
+		{"go1.22", "go1.22.1"},
+		{"go1.22.2", "go1.22.10"},
+		{"go1.22.9", "go1.22.10"},
+		{"go1.22.10", "go1.23rc1"},
+		{"go1.22rc1", "go1.22"},
+		{"go1.22beta1", "go1.22rc1"},
+		{"go1.9.2rc2", "go1.9.2"},
+		{"go1.9.2", "go1.9.10"},
+	} {
+		if !versionGreater(tt.newer, tt.older) || versionGreater(tt.older, tt.newer) {
+			t.Errorf("want %s newer than %s", tt.newer, tt.older)
+		}
+		if !versionLess(tt.older, tt.newer) || versionLess(tt.newer, tt.older) {
+			t.Errorf("want %s older than %s", tt.older, tt.newer)
+		}
+	}
+}
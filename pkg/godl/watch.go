@@ -0,0 +1,127 @@
+package godl
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// validateWatchPolicy checks -watch-policy.
+func validateWatchPolicy() error {
+	switch watchPolicy {
+	case "prefetch-only", "notify", "auto":
+		return nil
+	}
+	return errors.Errorf("invalid -watch-policy value %q, want prefetch-only, notify or auto", watchPolicy)
+}
+
+// watch runs until it is interrupted or terminated, checking for a release newer
+// than the toolchain in goRoot right away and then every -poll-interval, plus up
+// to a tenth of it at random so a fleet does not poll in step. A new release is
+// downloaded and verified into -cache-archives, by default the user cache, and
+// then handled according to -watch-policy. A failed check is a warning and is
+// retried at the next poll. uid and gid own the trees installed with -chown.
+func watch(ctx context.Context, src Source, iv InstalledVersion, goRoot string, uid, gid int) error {
+	if err := validateWatchPolicy(); err != nil {
+		return err
+	}
+	interval, err := time.ParseDuration(pollInterval)
+	if err != nil || interval <= 0 {
+		return errors.Errorf("invalid -poll-interval %q", pollInterval)
+	}
+	if cacheDir == "" {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			return errors.Wrap(err, "watch needs -cache-archives")
+		}
+		cacheDir = filepath.Join(dir, "godl", "archives")
+	}
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return err
+	}
+	// every poll asks the server, which the validators keep cheap
+	metaCacheTTL = 0
+	if watchPolicy == "auto" {
+		// nobody is there to confirm, and a watch that installs does so for real
+		dryRun, assumeYes = false, true
+	}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	fmt.Fprintf(stdout, "watching for releases newer than %s every %s, policy %s, caching into %s\n", iv.Version, interval, watchPolicy, cacheDir)
+	handled := make(map[string]bool)
+	for {
+		if err := watchOnce(ctx, src, &iv, goRoot, uid, gid, handled); err != nil && ctx.Err() == nil {
+			warnf("watch: %s", err)
+		}
+		wait := interval + time.Duration(rand.Int64N(int64(interval/10)+1))
+		select {
+		case <-ctx.Done():
+			fmt.Fprintln(stdout, "watch stopped")
+			return nil
+		case <-time.After(wait):
+		}
+	}
+}
+
+// watchOnce checks for a release newer than iv, refreshed from goRoot first since
+// an install may have changed it, and prefetches and handles it unless it was
+// handled before.
+func watchOnce(ctx context.Context, src Source, iv *InstalledVersion, goRoot string, uid, gid int, handled map[string]bool) error {
+	if goRoot != "" {
+		if v, err := readVersionFile(goRoot); err == nil {
+			iv.Version = v
+		}
+	}
+	file, err := getNewVersionFile(ctx, func(ctx context.Context) ([]Release, error) {
+		return Releases(ctx, ReleaseOptions{Source: src, Channel: "all"})
+	}, *iv)
+	if errors.Is(err, ErrNoNewVersion) {
+		logger.Info("watch poll", "installed", iv.Version, "new", false)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	v := fileVersion(file)
+	if handled[v] {
+		return nil
+	}
+	path, temp, err := fetchArchive(ctx, src, file)
+	if temp {
+		defer removeDownload(path)
+	}
+	if err != nil {
+		return err
+	}
+	if err := verifyArchive(file, path); err != nil {
+		// a copy that fails verification must not be installed from the cache later
+		if p, ok := cachedArchive(cacheDir, file); ok {
+			os.Remove(p)
+		}
+		return err
+	}
+	fmt.Fprintf(stdout, "prefetched %s into %s\n", file.Filename, cacheDir)
+	emit(streamEvent{Event: "prefetch", Version: v, File: file.Filename})
+	switch watchPolicy {
+	case "notify":
+		if err := reportUpdate(ctx, src, *iv, file); !errors.Is(err, ErrUpdateAvailable) {
+			return err
+		}
+	case "auto":
+		if err := checkMinorJump(iv.Version, v); err != nil {
+			return err
+		}
+		if err := installRelease(ctx, file, path, goRoot, *iv, uid, gid); err != nil {
+			return errors.Wrapf(err, "install %s", v)
+		}
+	}
+	handled[v] = true
+	return nil
+}
@@ -0,0 +1,56 @@
+package godl
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestWatchOnceAutoInstalls(t *testing.T) {
+	out := testSettings(t)
+	srv := newFakeServer(t, "go1.21.5", "go1.22.1")
+	goRoot := setupGoRoot(t, "go1.21.5")
+	set(t, &cacheDir, t.TempDir())
+	set(t, &watchPolicy, "prefetch-only")
+	goos, goarch := HostPlatform()
+	iv := InstalledVersion{Os: goos, Arch: goarch, Version: "go1.21.5"}
+
+	// prefetching leaves GOROOT alone
+	if err := watchOnce(context.Background(), srv.source(), &iv, goRoot, 0, 0, map[string]bool{}); err != nil {
+		t.Fatalf("watch: %v\n%s", err, out)
+	}
+	if v, _ := readVersionFile(goRoot); v != "go1.21.5" {
+		t.Fatalf("GOROOT has %s after a prefetch, want go1.21.5", v)
+	}
+	if _, ok := cachedArchive(cacheDir, srv.file("go1.22.1")); !ok {
+		t.Fatal("go1.22.1 was not prefetched")
+	}
+
+	// the auto policy installs from the cache within the same process
+	watchPolicy = "auto"
+	handled := map[string]bool{}
+	if err := watchOnce(context.Background(), srv.source(), &iv, goRoot, 0, 0, handled); err != nil {
+		t.Fatalf("watch: %v\n%s", err, out)
+	}
+	if v, err := readVersionFile(goRoot); err != nil || v != "go1.22.1" {
+		t.Fatalf("GOROOT has %q, %v, want go1.22.1\n%s", v, err, out)
+	}
+	backup := filepath.Join(filepath.Dir(goRoot), "go@go1.21.5")
+	if v, err := readVersionFile(backup); err != nil || v != "go1.21.5" {
+		t.Errorf("backup %s has %q, %v, want go1.21.5", backup, v, err)
+	}
+	if !handled["go1.22.1"] || result.Action != "installed" {
+		t.Errorf("handled %v, result %+v, want go1.22.1 installed", handled, result)
+	}
+	if n := srv.downloads.Load(); n != 1 {
+		t.Errorf("%d downloads, want 1 for the prefetch", n)
+	}
+
+	// the next poll finds the new version installed
+	if err := watchOnce(context.Background(), srv.source(), &iv, goRoot, 0, 0, handled); err != nil {
+		t.Fatal(err)
+	}
+	if iv.Version != "go1.22.1" {
+		t.Errorf("watching for releases newer than %s, want go1.22.1", iv.Version)
+	}
+}